@@ -40,21 +40,79 @@ func main() {
 		log.Fatalf("Failed to connect to redis: %v", err)
 	}
 	defer redisRepo.Close()
+	redisRepo.GeofenceTTL = cfg.GeofenceStateTTL()
+	redisRepo.LastLocationTTL = cfg.LastLocationTTL()
+
+	// Хранилище инцидентов: обычный PostgreSQL или PostGIS (сопоставление зон на стороне БД при холодном кеше)
+	var incidentRepo usecase.IncidentRepository = pgRepo
+	switch cfg.IncidentStore() {
+	case "postgres":
+	case "postgis":
+		postgisRepo, err := postgres.NewPostGIS(context.Background(), pgRepo)
+		if err != nil {
+			log.Fatalf("Failed to init postgis repository: %v", err)
+		}
+		incidentRepo = postgisRepo
+	default:
+		log.Fatalf("Unknown INCIDENT_STORE: %q", cfg.IncidentStore())
+	}
 
 	// 4. Инициализация сервисов (Application Layer)
-	incidentService := usecase.NewIncidentService(pgRepo, redisRepo)
-	// GeoService использует репозиторий инцидентов (postgres), репозиторий проверок (postgres), очередь (redis) и кеш (redis).
+	incidentService := usecase.NewIncidentService(incidentRepo, redisRepo)
+	// Пользователи, уже находящиеся в новой или расширенной зоне, оповещаются по последнему местоположению из Redis GEO
+	// (pgRepo тоже реализует LastLocationRepository — поиском по журналу проверок)
+	incidentService.LastLocations = redisRepo
+	incidentService.LastLocationMaxAge = cfg.LastLocationMaxAge()
+	incidentService.Outbox = pgRepo      // события для них пишутся в outbox и публикуются ретранслятором
+	incidentService.Geofence = redisRepo // вход в зону запоминается так же, как при проверке местоположения
+	// GeoService использует репозиторий инцидентов (postgres/postgis), репозиторий проверок (postgres), очередь (redis) и кеш (redis).
 	// Обратите внимание: pgRepo реализует и IncidentRepository, и LocationCheckRepository.
-	geoService := usecase.NewGeoService(pgRepo, pgRepo, redisRepo, redisRepo)
+	geoService := usecase.NewGeoService(incidentRepo, pgRepo, redisRepo, redisRepo)
+	geoService.IndexRefreshInterval = cfg.IndexRefreshInterval()
+	// Состояние пользователей в зонах хранится в Redis: вебхуки отправляются только на вход, выход и длительное пребывание
+	geoService.Geofence = redisRepo
+	geoService.DwellTime = cfg.GeofenceDwell()
+	// Последние местоположения пользователей для поиска тех, кто сейчас рядом с точкой или зоной
+	geoService.LastLocations = redisRepo
+
+	// Подписки хранятся в PostgreSQL; WEBHOOK_URL остается подписчиком по умолчанию, получающим все события
+	webhookService := usecase.NewWebhookService(redisRepo, pgRepo, cfg.WebhookURL())
+	webhookService.DefaultSecrets = cfg.WebhookSecrets()
+	webhookService.SecretGracePeriod = cfg.WebhookSecretGrace()
+	webhookService.Deliveries = pgRepo // журнал попыток доставки
 
 	// 5. Запуск воркера (Background Worker)
-	w := worker.New(redisRepo, cfg.WebhookURL())
+	w := worker.New(redisRepo, webhookService)
+	w.VisibilityTimeout = cfg.QueueVisibilityTimeout()
+	w.MaxAttempts = cfg.WebhookMaxAttempts()
+	w.MaxAge = cfg.WebhookMaxAge()
+	w.Concurrency = cfg.WorkerConcurrency()
 	workerCtx, workerCancel := context.WithCancel(context.Background())
+	// Задачи, поставленные прежней версией в списки Redis (до перехода на потоки), переносятся в потоки очередей
+	for _, queue := range []string{w.QueueName, w.DeliveryQueueName} {
+		if n, err := redisRepo.DrainLegacyQueue(workerCtx, queue); err != nil {
+			log.Printf("Failed to move legacy tasks of queue %s to the stream: %v", queue, err)
+		} else if n > 0 {
+			log.Printf("Moved %d legacy tasks of queue %s to the stream", n, queue)
+		}
+	}
 	go w.Start(workerCtx)
 
+	// Сброс локального индекса зон при изменении инцидентов на любом экземпляре (Redis pub/sub)
+	go geoService.WatchInvalidations(workerCtx)
+
+	// Публикация событий из outbox (записываются в PostgreSQL вместе с проверками местоположения) в очередь
+	outboxRelay := worker.NewOutboxRelay(pgRepo, redisRepo, cfg.OutboxPollInterval())
+	go outboxRelay.Start(workerCtx)
+
+	// Фоновое завершение истекших инцидентов
+	expiryJob := worker.NewExpiryJob(incidentService, cfg.ExpiryCheckInterval())
+	go expiryJob.Start(workerCtx)
+
 	// 6. Инициализация HTTP-обработчика и роутера
 	// Внедряем репозитории как "Pingers" для health-check
-	handler := delivery.NewHandler(incidentService, geoService, pgRepo, redisRepo, cfg.APIKey(), cfg.StatsWindow())
+	handler := delivery.NewHandler(incidentService, geoService, webhookService, pgRepo, redisRepo, cfg.APIKey(), cfg.StatsWindow())
+	handler.APIKeys = cfg.APIKeys() // автор изменений инцидентов определяется по ключу, а не по X-Operator
 	router := handler.InitRoutes()
 
 	// 7. Запуск HTTP-сервера
@@ -76,13 +134,21 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
+	// Сначала перестаем принимать запросы: новые проверки больше не порождают событий
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		// Не log.Fatal: соединения с БД и Redis должны закрыться через defer
+		log.Printf("Server forced to shutdown: %v", err)
+	}
 
-	workerCancel() // Останавливаем воркер
+	workerCancel() // Останавливаем воркер и фоновые задачи
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown: ", err)
+	// Даем воркеру доставить начатые вебхуки; незавершенные вернутся в очередь
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.WorkerShutdownTimeout())
+	defer drainCancel()
+	if err := w.Shutdown(drainCtx); err != nil {
+		log.Printf("Worker shutdown timed out: %v", err)
 	}
 
 	log.Println("Server exiting")
@@ -7,8 +7,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/paincake00/geocore/internal/webhooksig"
 )
 
 // Event структура события, хранимая в памяти мок-сервера.
@@ -28,6 +31,14 @@ func main() {
 		port = "9090"
 	}
 
+	// WEBHOOK_SECRETS: секреты через запятую, которыми подписываются вебхуки (пусто — подпись не проверяется)
+	var secrets []string
+	for _, s := range strings.Split(os.Getenv("WEBHOOK_SECRETS"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// POST: Принимаем вебхук
 		if r.Method == http.MethodPost {
@@ -39,6 +50,16 @@ func main() {
 			}
 			defer r.Body.Close()
 
+			// Проверяем подпись, если заданы секреты
+			if len(secrets) > 0 {
+				err := webhooksig.Verify(secrets, r.Header.Get(webhooksig.TimestampHeader), r.Header.Get(webhooksig.SignatureHeader), body, webhooksig.DefaultTolerance, time.Now())
+				if err != nil {
+					log.Printf("Rejected webhook: %v", err)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+
 			log.Printf("Received Webhook: %s", string(body))
 
 			// Check if body is valid JSON
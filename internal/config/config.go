@@ -2,39 +2,96 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/paincake00/geocore/internal/env"
 )
 
 // Config хранит настройки приложения.
 type Config struct {
-	httpPort    string
-	databaseURL string
-	redisAddr   string
-	webhookURL  string
-	apiKey      string
-	statsWindow int
+	httpPort        string
+	databaseURL     string
+	redisAddr       string
+	webhookURL      string
+	apiKey          string
+	apiKeys         string // именованные API-ключи "имя:ключ" через запятую
+	statsWindow     int
+	indexTTL        int
+	incidentStore   string // реализация хранилища инцидентов: "postgres" или "postgis"
+	geofenceDwell   int
+	geofenceTTL     int
+	expiryCheck     int
+	visibility      int
+	webhookSecrets  string // секреты подписи для WEBHOOK_URL через запятую: первый — текущий
+	webhookAttempts int
+	webhookMaxAge   int
+	secretGrace     int // сколько после ротации действует прежний секрет подписки
+	workerPool      int
+	workerDrain     int
+	outboxInterval  int
+	lastLocationAge int
+	lastLocationTTL int
 }
 
 // Load загружает конфигурацию из переменных окружения.
 func Load() *Config {
 	return &Config{
-		httpPort:    env.GetString("HTTP_PORT", "8080"),
-		databaseURL: getDatabaseURL(),
-		redisAddr:   getRedisAddr(),
-		webhookURL:  env.GetString("WEBHOOK_URL", "http://localhost:9090"),
-		apiKey:      env.GetString("API_KEY", ""), // пустое значение по умолчанию
-		statsWindow: env.GetInt("STATS_TIME_WINDOW_MINUTES", 30),
+		httpPort:        env.GetString("HTTP_PORT", "8080"),
+		databaseURL:     getDatabaseURL(),
+		redisAddr:       getRedisAddr(),
+		webhookURL:      env.GetString("WEBHOOK_URL", "http://localhost:9090"),
+		apiKey:          env.GetString("API_KEY", ""), // пустое значение по умолчанию
+		apiKeys:         env.GetString("API_KEYS", ""),
+		statsWindow:     env.GetInt("STATS_TIME_WINDOW_MINUTES", 30),
+		indexTTL:        env.GetInt("INDEX_REFRESH_INTERVAL_SECONDS", 5),
+		incidentStore:   env.GetString("INCIDENT_STORE", "postgres"),
+		geofenceDwell:   env.GetInt("GEOFENCE_DWELL_SECONDS", 300),
+		geofenceTTL:     env.GetInt("GEOFENCE_STATE_TTL_SECONDS", 86400),
+		expiryCheck:     env.GetInt("EXPIRY_CHECK_INTERVAL_SECONDS", 30),
+		visibility:      env.GetInt("QUEUE_VISIBILITY_TIMEOUT_SECONDS", 60),
+		webhookSecrets:  env.GetString("WEBHOOK_SECRETS", ""),
+		webhookAttempts: env.GetInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		webhookMaxAge:   env.GetInt("WEBHOOK_MAX_AGE_SECONDS", 86400),
+		secretGrace:     env.GetInt("WEBHOOK_SECRET_GRACE_SECONDS", 86400),
+		workerPool:      env.GetInt("WORKER_CONCURRENCY", 10),
+		workerDrain:     env.GetInt("WORKER_SHUTDOWN_TIMEOUT_SECONDS", 15),
+		outboxInterval:  env.GetInt("OUTBOX_POLL_INTERVAL_MS", 500),
+		lastLocationAge: env.GetInt("LAST_LOCATION_MAX_AGE_SECONDS", 900),
+		lastLocationTTL: env.GetInt("LAST_LOCATION_TTL_SECONDS", 3600),
 	}
 }
 
 // Геттеры для доступа к приватным полям конфигурации
-func (c *Config) HTTPPort() string    { return c.httpPort }
-func (c *Config) DatabaseURL() string { return c.databaseURL }
-func (c *Config) RedisAddr() string   { return c.redisAddr }
-func (c *Config) WebhookURL() string  { return c.webhookURL }
-func (c *Config) APIKey() string      { return c.apiKey }
-func (c *Config) StatsWindow() int    { return c.statsWindow }
+func (c *Config) HTTPPort() string                      { return c.httpPort }
+func (c *Config) DatabaseURL() string                   { return c.databaseURL }
+func (c *Config) RedisAddr() string                     { return c.redisAddr }
+func (c *Config) WebhookURL() string                    { return c.webhookURL }
+func (c *Config) APIKey() string                        { return c.apiKey }
+func (c *Config) APIKeys() map[string]string            { return splitNamed(c.apiKeys) }
+func (c *Config) StatsWindow() int                      { return c.statsWindow }
+func (c *Config) IndexRefreshInterval() time.Duration   { return seconds(c.indexTTL) }
+func (c *Config) IncidentStore() string                 { return c.incidentStore }
+func (c *Config) GeofenceDwell() time.Duration          { return seconds(c.geofenceDwell) }
+func (c *Config) GeofenceStateTTL() time.Duration       { return seconds(c.geofenceTTL) }
+func (c *Config) ExpiryCheckInterval() time.Duration    { return seconds(c.expiryCheck) }
+func (c *Config) QueueVisibilityTimeout() time.Duration { return seconds(c.visibility) }
+func (c *Config) WebhookSecrets() []string              { return splitList(c.webhookSecrets) }
+func (c *Config) WebhookMaxAttempts() int               { return c.webhookAttempts }
+func (c *Config) WebhookMaxAge() time.Duration          { return seconds(c.webhookMaxAge) }
+func (c *Config) WebhookSecretGrace() time.Duration     { return seconds(c.secretGrace) }
+func (c *Config) WorkerConcurrency() int                { return c.workerPool }
+func (c *Config) WorkerShutdownTimeout() time.Duration  { return seconds(c.workerDrain) }
+func (c *Config) LastLocationMaxAge() time.Duration     { return seconds(c.lastLocationAge) }
+func (c *Config) LastLocationTTL() time.Duration        { return seconds(c.lastLocationTTL) }
+func (c *Config) OutboxPollInterval() time.Duration {
+	return time.Duration(c.outboxInterval) * time.Millisecond
+}
+
+// seconds переводит значение настройки в секундах в time.Duration.
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
 
 // getDatabaseURL формирует строку подключения к PostgreSQL.
 func getDatabaseURL() string {
@@ -63,3 +120,26 @@ func getRedisAddr() string {
 	port := env.GetString("REDIS_PORT", "6379")
 	return fmt.Sprintf("%s:%s", host, port)
 }
+
+// splitList разбирает список значений, перечисленных через запятую.
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// splitNamed разбирает список пар "имя:значение", перечисленных через запятую. Пары без имени или значения пропускаются.
+func splitNamed(s string) map[string]string {
+	res := make(map[string]string)
+	for _, v := range splitList(s) {
+		name, value, ok := strings.Cut(v, ":")
+		if name, value = strings.TrimSpace(name), strings.TrimSpace(value); ok && name != "" && value != "" {
+			res[name] = value
+		}
+	}
+	return res
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// FeatureCollection коллекция объектов GeoJSON для обмена зонами с ГИС.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature объект GeoJSON. Круговые зоны передаются как Point со свойством radius_meters,
+// полигональные — как Polygon/MultiPolygon.
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// ImportFeatureError ошибка разбора конкретного объекта коллекции.
+type ImportFeatureError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// exportGeoJSON выгружает все активные инциденты в виде FeatureCollection.
+func (h *Handler) exportGeoJSON(c *gin.Context) {
+	incidents, err := h.IncidentService.GetAllActive(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc := FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0, len(incidents))}
+	for _, i := range incidents {
+		f, err := incidentToFeature(i)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fc.Features = append(fc.Features, f)
+	}
+
+	c.JSON(http.StatusOK, fc)
+}
+
+// importGeoJSON создает инциденты из FeatureCollection.
+// Если хотя бы один объект некорректен, ничего не создается и возвращается список ошибок по объектам.
+func (h *Handler) importGeoJSON(c *gin.Context) {
+	var fc FeatureCollection
+	if err := c.ShouldBindJSON(&fc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if fc.Type != "FeatureCollection" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected FeatureCollection"})
+		return
+	}
+	if len(fc.Features) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "feature collection is empty"})
+		return
+	}
+
+	incidents := make([]*entity.Incident, 0, len(fc.Features))
+	var featureErrors []ImportFeatureError
+	for n, f := range fc.Features {
+		i, err := featureToIncident(f)
+		if err == nil {
+			err = validateIncident(i)
+		}
+		if err != nil {
+			featureErrors = append(featureErrors, ImportFeatureError{Index: n, Error: err.Error()})
+			continue
+		}
+		incidents = append(incidents, i)
+	}
+
+	if len(featureErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid features", "errors": featureErrors})
+		return
+	}
+
+	if err := h.IncidentService.Import(c.Request.Context(), incidents); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"created": len(incidents), "incidents": incidents})
+}
+
+// incidentToFeature преобразует инцидент в объект GeoJSON.
+func incidentToFeature(i *entity.Incident) (Feature, error) {
+	props := map[string]interface{}{
+		"title":       i.Title,
+		"description": i.Description,
+		"severity":    i.Severity,
+		"category":    i.Category,
+		"created_at":  i.CreatedAt.Format(time.RFC3339),
+	}
+
+	var geometry []byte
+	var err error
+	if i.Geometry != nil {
+		geometry, err = json.Marshal(i.Geometry)
+	} else {
+		props["radius_meters"] = i.RadiusMeters
+		geometry, err = json.Marshal(map[string]interface{}{
+			"type":        "Point",
+			"coordinates": entity.Position{i.Longitude, i.Latitude},
+		})
+	}
+	if err != nil {
+		return Feature{}, err
+	}
+
+	return Feature{Type: "Feature", ID: i.ID, Geometry: geometry, Properties: props}, nil
+}
+
+// featureToIncident преобразует объект GeoJSON в инцидент (без валидации бизнес-правил).
+func featureToIncident(f Feature) (*entity.Incident, error) {
+	if f.Type != "Feature" {
+		return nil, fmt.Errorf("unexpected object type %q", f.Type)
+	}
+	if len(f.Geometry) == 0 || string(f.Geometry) == "null" {
+		return nil, errors.New("geometry is required")
+	}
+
+	var i entity.Incident
+	if title, ok := f.Properties["title"].(string); ok {
+		i.Title = title
+	}
+	if description, ok := f.Properties["description"].(string); ok {
+		i.Description = description
+	}
+	if severity, ok := f.Properties["severity"].(string); ok {
+		i.Severity = severity
+	}
+	if category, ok := f.Properties["category"].(string); ok {
+		i.Category = category
+	}
+
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(f.Geometry, &head); err != nil {
+		return nil, err
+	}
+
+	switch head.Type {
+	case "Point":
+		var point struct {
+			Coordinates entity.Position `json:"coordinates"`
+		}
+		if err := json.Unmarshal(f.Geometry, &point); err != nil {
+			return nil, fmt.Errorf("invalid point coordinates: %w", err)
+		}
+		radius, ok := f.Properties["radius_meters"].(float64)
+		if !ok {
+			return nil, errors.New("point feature requires numeric radius_meters property")
+		}
+		i.Latitude, i.Longitude = point.Coordinates.Lat(), point.Coordinates.Lon()
+		i.RadiusMeters = int(radius)
+	case entity.GeometryPolygon, entity.GeometryMultiPolygon:
+		i.Geometry = &entity.Geometry{}
+		if err := json.Unmarshal(f.Geometry, i.Geometry); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", head.Type)
+	}
+
+	return &i, nil
+}
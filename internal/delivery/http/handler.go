@@ -18,17 +18,22 @@ type Pinger interface {
 type Handler struct {
 	IncidentService *usecase.IncidentService
 	GeoService      *usecase.GeoService
+	WebhookService  *usecase.WebhookService
 	DBPinger        Pinger
 	RedisPinger     Pinger
 	APIKey          string
 	StatsWindow     int
+
+	// APIKeys именованные API-ключи (имя -> ключ) в дополнение к APIKey; имя ключа записывается автором изменений.
+	APIKeys map[string]string
 }
 
 // NewHandler создает новый экземпляр HTTP-обработчика.
-func NewHandler(is *usecase.IncidentService, gs *usecase.GeoService, db Pinger, rds Pinger, apiKey string, statsWindow int) *Handler {
+func NewHandler(is *usecase.IncidentService, gs *usecase.GeoService, ws *usecase.WebhookService, db Pinger, rds Pinger, apiKey string, statsWindow int) *Handler {
 	return &Handler{
 		IncidentService: is,
 		GeoService:      gs,
+		WebhookService:  ws,
 		DBPinger:        db,
 		RedisPinger:     rds,
 		APIKey:          apiKey,
@@ -46,19 +51,46 @@ func (h *Handler) InitRoutes() *gin.Engine {
 	{
 		incidents := v1.Group("/incidents")
 		// Применяем middleware авторизации только к группе инцидентов
-		incidents.Use(middleware.AuthMiddleware(h.APIKey))
+		incidents.Use(middleware.AuthMiddleware(h.APIKey, h.APIKeys))
 		{
 			incidents.POST("", h.createIncident)
 			incidents.GET("", h.getIncidents)
 			incidents.GET("/stats", h.getStats) // Отдельно от /:id
+			incidents.GET("/nearest", h.getNearestIncidents)
+			incidents.GET("/geojson", h.exportGeoJSON)
+			incidents.POST("/import", h.importGeoJSON)
 			incidents.GET("/:id", h.getIncident)
 			incidents.PUT("/:id", h.updateIncident)
 			incidents.DELETE("/:id", h.deleteIncident)
+			incidents.GET("/:id/revisions", h.getIncidentRevisions)
+			incidents.POST("/:id/revisions/:revision/restore", h.restoreIncidentRevision)
+		}
+
+		webhooks := v1.Group("/webhooks")
+		webhooks.Use(middleware.AuthMiddleware(h.APIKey, h.APIKeys))
+		{
+			webhooks.POST("/subscriptions", h.createSubscription)
+			webhooks.GET("/subscriptions", h.getSubscriptions)
+			webhooks.GET("/subscriptions/:id", h.getSubscription)
+			webhooks.PUT("/subscriptions/:id", h.updateSubscription)
+			webhooks.DELETE("/subscriptions/:id", h.deleteSubscription)
+			webhooks.POST("/subscriptions/:id/rotate-secret", h.rotateSubscriptionSecret)
+			webhooks.GET("/deliveries", h.getDeliveries)
+			webhooks.POST("/deliveries/resend", h.resendFailedDeliveries) // Отдельно от /:id
+			webhooks.GET("/deliveries/:id", h.getDelivery)
+			webhooks.POST("/deliveries/:id/resend", h.resendDelivery)
+			webhooks.GET("/dead-letters", h.getDeadLetters)
+			webhooks.POST("/dead-letters/:id/replay", h.replayDeadLetter)
 		}
 
 		location := v1.Group("/location")
 		{
 			location.POST("/check", h.checkLocation)
+			location.POST("/check/batch", h.checkLocationBatch)
+			location.POST("/route", h.checkRoute)
+			// Журнал проверок содержит перемещения пользователей, поэтому доступен только с API Key
+			location.GET("/checks", middleware.AuthMiddleware(h.APIKey, h.APIKeys), h.getLocationChecks)
+			location.GET("/users/nearby", middleware.AuthMiddleware(h.APIKey, h.APIKeys), h.getUsersNearby)
 		}
 	}
 
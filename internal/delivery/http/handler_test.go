@@ -2,11 +2,17 @@ package http_test
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,8 +25,52 @@ import (
 // --- Моки ---
 
 type MockIncidentRepo struct {
-	Incidents map[int]*entity.Incident
-	Stats     map[int]int
+	Incidents  map[int]*entity.Incident
+	Stats      map[int]int
+	LastFilter entity.IncidentFilter // параметры последнего вызова GetAll
+	Revisions  []*entity.IncidentRevision
+	Outbox     []*entity.OutboxMessage // сообщения, записанные вместе с изменениями инцидентов
+	// AfterGetActive вызывается после чтения инцидентов для кеша (имитация конкурентного изменения)
+	AfterGetActive func()
+}
+
+// record добавляет ревизию истории со снимком инцидента и автором из контекста.
+func (m *MockIncidentRepo) record(ctx context.Context, i *entity.Incident, action string) {
+	snapshot := *i
+	n := 1
+	for _, rev := range m.Revisions {
+		if rev.IncidentID == i.ID {
+			n++
+		}
+	}
+	m.Revisions = append(m.Revisions, &entity.IncidentRevision{
+		ID: int64(len(m.Revisions) + 1), IncidentID: i.ID, Revision: n, Action: action,
+		Actor: entity.ActorFromContext(ctx), Operator: entity.OperatorFromContext(ctx), Incident: &snapshot, CreatedAt: time.Now(),
+	})
+}
+
+// saveOutbox сохраняет сообщения outbox по записанному инциденту, как это делает хранилище в транзакции изменения.
+func (m *MockIncidentRepo) saveOutbox(events entity.OutboxFunc, i *entity.Incident) error {
+	if events == nil {
+		return nil
+	}
+	messages, err := events(i)
+	if err != nil {
+		return err
+	}
+	m.Outbox = append(m.Outbox, messages...)
+	return nil
+}
+
+// Events возвращает события из сообщений outbox.
+func (m *MockIncidentRepo) Events() []entity.WebhookEvent {
+	var events []entity.WebhookEvent
+	for _, msg := range m.Outbox {
+		var e entity.WebhookEvent
+		json.Unmarshal(msg.Payload, &e)
+		events = append(events, e)
+	}
+	return events
 }
 
 func NewMockIncidentRepo() *MockIncidentRepo {
@@ -30,10 +80,20 @@ func NewMockIncidentRepo() *MockIncidentRepo {
 	}
 }
 
-func (m *MockIncidentRepo) Create(ctx context.Context, i *entity.Incident) error {
+func (m *MockIncidentRepo) Create(ctx context.Context, i *entity.Incident, events entity.OutboxFunc) error {
 	i.ID = len(m.Incidents) + 1
 	i.CreatedAt = time.Now()
 	m.Incidents[i.ID] = i
+	m.record(ctx, i, entity.RevisionActionCreated)
+	return m.saveOutbox(events, i)
+}
+
+func (m *MockIncidentRepo) CreateBatch(ctx context.Context, incidents []*entity.Incident, events entity.OutboxFunc) error {
+	for _, i := range incidents {
+		if err := m.Create(ctx, i, events); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -44,7 +104,8 @@ func (m *MockIncidentRepo) GetByID(ctx context.Context, id int) (*entity.Inciden
 	return nil, fmt.Errorf("not found")
 }
 
-func (m *MockIncidentRepo) GetAll(ctx context.Context, limit, offset int) ([]*entity.Incident, error) {
+func (m *MockIncidentRepo) GetAll(ctx context.Context, filter entity.IncidentFilter) ([]*entity.Incident, error) {
+	m.LastFilter = filter
 	var res []*entity.Incident
 	for _, i := range m.Incidents {
 		res = append(res, i)
@@ -53,58 +114,477 @@ func (m *MockIncidentRepo) GetAll(ctx context.Context, limit, offset int) ([]*en
 }
 
 func (m *MockIncidentRepo) GetAllActive(ctx context.Context) ([]*entity.Incident, error) {
-	return m.GetAll(ctx, 0, 0)
+	var res []*entity.Incident
+	for _, i := range m.Incidents {
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func (m *MockIncidentRepo) GetActiveOrScheduled(ctx context.Context, until time.Time) ([]*entity.Incident, error) {
+	var res []*entity.Incident
+	for _, i := range m.Incidents {
+		if i.StartsAt == nil || !i.StartsAt.After(until) {
+			res = append(res, i)
+		}
+	}
+	if m.AfterGetActive != nil {
+		m.AfterGetActive()
+	}
+	return res, nil
+}
+
+func (m *MockIncidentRepo) ExpireIncidents(ctx context.Context, events entity.OutboxFunc) ([]*entity.Incident, error) {
+	var res []*entity.Incident
+	for _, i := range m.Incidents {
+		if i.Status == entity.IncidentStatusActive && i.ExpiresAt != nil && !i.ExpiresAt.After(time.Now()) {
+			i.Status = entity.IncidentStatusResolved
+			res = append(res, i)
+			if err := m.saveOutbox(events, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
 }
 
-func (m *MockIncidentRepo) Update(ctx context.Context, i *entity.Incident) error {
+func (m *MockIncidentRepo) Update(ctx context.Context, i *entity.Incident, events entity.OutboxFunc) error {
 	if _, ok := m.Incidents[i.ID]; !ok {
 		return fmt.Errorf("not found")
 	}
 	m.Incidents[i.ID] = i
-	return nil
+	m.record(ctx, i, entity.RevisionActionUpdated)
+	return m.saveOutbox(events, i)
 }
 
-func (m *MockIncidentRepo) Delete(ctx context.Context, id int) error {
-	if _, ok := m.Incidents[id]; !ok {
+func (m *MockIncidentRepo) Delete(ctx context.Context, id int, events entity.OutboxFunc) error {
+	i, ok := m.Incidents[id]
+	if !ok {
 		return fmt.Errorf("not found")
 	}
 	delete(m.Incidents, id)
-	return nil
+	m.record(ctx, i, entity.RevisionActionDeleted)
+	return m.saveOutbox(events, i)
+}
+
+func (m *MockIncidentRepo) GetRevisions(ctx context.Context, incidentID int) ([]*entity.IncidentRevision, error) {
+	var res []*entity.IncidentRevision
+	for _, rev := range m.Revisions {
+		if rev.IncidentID == incidentID {
+			res = append(res, rev)
+		}
+	}
+	return res, nil
+}
+
+func (m *MockIncidentRepo) RestoreRevision(ctx context.Context, incidentID, revision int, events entity.OutboxFunc) (*entity.Incident, error) {
+	for _, rev := range m.Revisions {
+		if rev.IncidentID == incidentID && rev.Revision == revision {
+			restored := *rev.Incident
+			m.Incidents[incidentID] = &restored
+			m.record(ctx, &restored, entity.RevisionActionRestored)
+			return &restored, m.saveOutbox(events, &restored)
+		}
+	}
+	return nil, fmt.Errorf("not found")
 }
 
-func (m *MockIncidentRepo) GetStats(ctx context.Context, windowMinutes int) (map[int]int, error) {
+func (m *MockIncidentRepo) GetStats(ctx context.Context, windowMinutes int, filter entity.StatsFilter) (map[int]int, error) {
 	return m.Stats, nil
 }
 
 // Проверка реализации интерфейса
 var _ usecase.IncidentRepository = (*MockIncidentRepo)(nil)
 
-type MockLocationRepo struct{}
+type MockLocationRepo struct {
+	mu      sync.Mutex
+	Checks  []*entity.LocationCheck
+	Matches map[int][]int
+	Outbox  []*entity.OutboxMessage
+	Err     error
+}
 
-func (m *MockLocationRepo) CreateLocationCheck(ctx context.Context, check *entity.LocationCheck) error {
-	check.ID = 1
+func (m *MockLocationRepo) SaveLocationCheck(ctx context.Context, check *entity.LocationCheck, incidentIDs []int, outbox []*entity.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	check.ID = len(m.Checks) + 1
 	check.CheckedAt = time.Now()
+	m.Checks = append(m.Checks, check)
+	if m.Matches == nil {
+		m.Matches = make(map[int][]int)
+	}
+	m.Matches[check.ID] = incidentIDs
+	m.Outbox = append(m.Outbox, outbox...)
+	return nil
+}
+
+// SaveOutbox имитирует запись outbox вне проверки (pgRepo реализует и LocationCheckRepository, и OutboxWriter).
+func (m *MockLocationRepo) SaveOutbox(ctx context.Context, messages []*entity.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Outbox = append(m.Outbox, messages...)
+	return nil
+}
+
+func (m *MockLocationRepo) SaveLocationChecks(ctx context.Context, checks []*entity.LocationCheck, matches [][]int, outbox []*entity.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.Matches == nil {
+		m.Matches = make(map[int][]int)
+	}
+	for n, check := range checks {
+		check.ID = len(m.Checks) + 1
+		m.Checks = append(m.Checks, check)
+		m.Matches[check.ID] = matches[n]
+	}
+	m.Outbox = append(m.Outbox, outbox...)
 	return nil
 }
-func (m *MockLocationRepo) RecordIncidentMatch(ctx context.Context, checkID, incidentID int) error {
+
+func (m *MockLocationRepo) GetLocationChecks(ctx context.Context, f entity.CheckFilter) ([]*entity.LocationCheck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checks := slices.Clone(m.Checks)
+	slices.SortFunc(checks, func(a, b *entity.LocationCheck) int {
+		return cmp.Or(b.CheckedAt.Compare(a.CheckedAt), cmp.Compare(b.ID, a.ID))
+	})
+	var res []*entity.LocationCheck
+	for _, c := range checks {
+		if f.After != nil && (c.CheckedAt.After(f.After.Time) || c.CheckedAt.Equal(f.After.Time) && int64(c.ID) >= f.After.ID) {
+			continue
+		}
+		if f.UserID != "" && c.UserID != f.UserID {
+			continue
+		}
+		res = append(res, &entity.LocationCheck{ID: c.ID, UserID: c.UserID, Latitude: c.Latitude, Longitude: c.Longitude, CheckedAt: c.CheckedAt, IncidentIDs: m.Matches[c.ID]})
+		if len(res) == f.Limit {
+			break
+		}
+	}
+	return res, nil
+}
+
+func (m *MockLocationRepo) FindLastLocations(ctx context.Context, area entity.BBox, since time.Time) ([]*entity.LocationCheck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := make(map[string]*entity.LocationCheck)
+	for _, c := range m.Checks {
+		if prev, ok := last[c.UserID]; !c.CheckedAt.Before(since) && (!ok || !c.CheckedAt.Before(prev.CheckedAt)) {
+			last[c.UserID] = c
+		}
+	}
+	var res []*entity.LocationCheck
+	for _, c := range last {
+		if c.Latitude >= area.MinLat && c.Latitude <= area.MaxLat && c.Longitude >= area.MinLon && c.Longitude <= area.MaxLon {
+			res = append(res, c)
+		}
+	}
+	slices.SortFunc(res, func(a, b *entity.LocationCheck) int { return cmp.Compare(a.UserID, b.UserID) })
+	return res, nil
+}
+
+// MockLastLocationStore хранилище последних местоположений в памяти (расстояния — по сфере).
+type MockLastLocationStore struct {
+	mu    sync.Mutex
+	Users map[string]*entity.UserLocation
+}
+
+func (m *MockLastLocationStore) SaveLastLocations(ctx context.Context, checks []*entity.LocationCheck) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Users == nil {
+		m.Users = make(map[string]*entity.UserLocation)
+	}
+	for _, c := range checks {
+		if prev, ok := m.Users[c.UserID]; ok && prev.SeenAt.After(c.PointTime()) {
+			continue
+		}
+		m.Users[c.UserID] = &entity.UserLocation{UserID: c.UserID, Latitude: c.Latitude, Longitude: c.Longitude, SeenAt: c.PointTime()}
+	}
 	return nil
 }
 
-type MockQueueRepo struct{}
+func (m *MockLastLocationStore) FindUsersWithin(ctx context.Context, lat, lon, meters float64) ([]*entity.UserLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*entity.UserLocation
+	for _, u := range m.Users {
+		dLat, dLon := (u.Latitude-lat)*math.Pi/180, (u.Longitude-lon)*math.Pi/180
+		a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat*math.Pi/180)*math.Cos(u.Latitude*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+		if d := 2 * 6371000 * math.Asin(math.Sqrt(a)); d <= meters {
+			found := *u
+			found.DistanceMeters = d
+			res = append(res, &found)
+		}
+	}
+	slices.SortFunc(res, func(a, b *entity.UserLocation) int { return cmp.Compare(a.DistanceMeters, b.DistanceMeters) })
+	return res, nil
+}
+
+func (m *MockLastLocationStore) FindLastLocations(ctx context.Context, area entity.BBox, since time.Time) ([]*entity.LocationCheck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*entity.LocationCheck
+	for _, u := range m.Users {
+		if !u.SeenAt.Before(since) && u.Latitude >= area.MinLat && u.Latitude <= area.MaxLat && u.Longitude >= area.MinLon && u.Longitude <= area.MaxLon {
+			res = append(res, &entity.LocationCheck{UserID: u.UserID, Latitude: u.Latitude, Longitude: u.Longitude, CheckedAt: u.SeenAt})
+		}
+	}
+	return res, nil
+}
+
+type MockQueueRepo struct {
+	mu          sync.Mutex
+	Enqueued    []interface{}
+	DeadLetters []*entity.DeadLetter
+}
 
 func (m *MockQueueRepo) Enqueue(ctx context.Context, task string, payload interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Enqueued = append(m.Enqueued, payload)
+	return nil
+}
+func (m *MockQueueRepo) Dequeue(ctx context.Context, task string) (*entity.QueueTask, error) {
+	return nil, nil
+}
+func (m *MockQueueRepo) Ack(ctx context.Context, task string, taskID string) error { return nil }
+func (m *MockQueueRepo) Reclaim(ctx context.Context, task string, minIdle time.Duration, count int) ([]*entity.QueueTask, error) {
+	return nil, nil
+}
+func (m *MockQueueRepo) Retry(ctx context.Context, task string, t *entity.QueueTask, payload interface{}, at time.Time) error {
+	return nil
+}
+func (m *MockQueueRepo) PromoteDue(ctx context.Context, task string, limit int) (int, error) {
+	return 0, nil
+}
+func (m *MockQueueRepo) DeadLetter(ctx context.Context, task string, t *entity.QueueTask, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.DeadLetters = append(m.DeadLetters, &entity.DeadLetter{ID: t.ID, Queue: task, TaskID: t.ID, Payload: json.RawMessage(t.Payload), Reason: reason})
 	return nil
 }
-func (m *MockQueueRepo) Dequeue(ctx context.Context, task string) (string, error) {
-	return "", nil
+func (m *MockQueueRepo) ListDeadLetters(ctx context.Context, limit int) ([]*entity.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.DeadLetters, nil
+}
+func (m *MockQueueRepo) ReplayDeadLetter(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n, d := range m.DeadLetters {
+		if d.ID == id {
+			m.Enqueued = append(m.Enqueued, d.Payload)
+			m.DeadLetters = append(m.DeadLetters[:n], m.DeadLetters[n+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("not found")
 }
 
-type MockCache struct{}
+// MockCache всегда пуст; уведомления об инвалидации доставляются подписчикам, как через Redis pub/sub.
+type MockCache struct {
+	mu          sync.Mutex
+	subscribers []chan struct{}
+}
 
-func (m *MockCache) SetIncidents(ctx context.Context, incidents []*entity.Incident) error { return nil }
+func (m *MockCache) SetIncidents(ctx context.Context, incidents []*entity.Incident, version int64) error {
+	return nil
+}
+func (m *MockCache) IncidentsVersion(ctx context.Context) (int64, error) { return 0, nil }
 func (m *MockCache) GetIncidents(ctx context.Context) ([]*entity.Incident, error) {
 	return nil, nil // Cache miss
 }
+func (m *MockCache) InvalidateIncidents(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+func (m *MockCache) SubscribeInvalidations(ctx context.Context) (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	m.subscribers = append(m.subscribers, ch)
+	return ch, nil
+}
+
+type MockSubscriptionRepo struct {
+	mu   sync.Mutex
+	Subs map[int]*entity.WebhookSubscription
+}
+
+func NewMockSubscriptionRepo() *MockSubscriptionRepo {
+	return &MockSubscriptionRepo{Subs: make(map[int]*entity.WebhookSubscription)}
+}
+
+func (m *MockSubscriptionRepo) CreateSubscription(ctx context.Context, s *entity.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.ID = len(m.Subs) + 1
+	s.CreatedAt = time.Now()
+	m.Subs[s.ID] = s
+	return nil
+}
+func (m *MockSubscriptionRepo) GetSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.Subs[id]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("not found")
+}
+func (m *MockSubscriptionRepo) GetSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*entity.WebhookSubscription
+	for _, id := range slices.Sorted(maps.Keys(m.Subs)) {
+		res = append(res, m.Subs[id])
+	}
+	return res, nil
+}
+func (m *MockSubscriptionRepo) GetActiveSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	all, _ := m.GetSubscriptions(ctx)
+	var res []*entity.WebhookSubscription
+	for _, s := range all {
+		if s.Active {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+func (m *MockSubscriptionRepo) UpdateSubscription(ctx context.Context, s *entity.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.Subs[s.ID]
+	if !ok {
+		return fmt.Errorf("not found")
+	}
+	s.Secret, s.PreviousSecrets, s.CreatedAt = current.Secret, current.PreviousSecrets, current.CreatedAt
+	m.Subs[s.ID] = s
+	return nil
+}
+func (m *MockSubscriptionRepo) DeleteSubscription(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Subs[id]; !ok {
+		return fmt.Errorf("not found")
+	}
+	delete(m.Subs, id)
+	return nil
+}
+
+func (m *MockSubscriptionRepo) RotateSubscriptionSecret(ctx context.Context, id int, secret string, grace time.Duration, revokePrevious bool) (*entity.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.Subs[id]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	s.RotateSecret(secret, time.Now(), grace, revokePrevious)
+	return s, nil
+}
+
+var _ usecase.SubscriptionRepository = (*MockSubscriptionRepo)(nil)
+
+// MockDeliveryLog журнал доставок в памяти.
+type MockDeliveryLog struct {
+	mu         sync.Mutex
+	Deliveries []*entity.WebhookDelivery
+}
+
+func (m *MockDeliveryLog) RecordDelivery(ctx context.Context, d *entity.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.ID = int64(len(m.Deliveries) + 1)
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	m.Deliveries = append(m.Deliveries, d)
+	return nil
+}
+func (m *MockDeliveryLog) GetDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || int(id) > len(m.Deliveries) {
+		return nil, fmt.Errorf("not found")
+	}
+	return m.Deliveries[id-1], nil
+}
+func (m *MockDeliveryLog) GetDeliveries(ctx context.Context, f entity.DeliveryFilter) ([]*entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*entity.WebhookDelivery
+	for _, d := range slices.Backward(m.Deliveries) {
+		if (f.Status == "" || d.Status == f.Status) && (f.IncidentID == nil || d.IncidentID == *f.IncidentID) &&
+			(f.UserID == "" || d.UserID == f.UserID) {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+func (m *MockDeliveryLog) GetFailedDeliveries(ctx context.Context, from, to time.Time, subscriptionID *int, limit int) ([]*entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := make(map[string]*entity.WebhookDelivery)
+	succeeded := make(map[string]bool)
+	for _, d := range m.Deliveries {
+		if d.Status == entity.DeliveryStatusSucceeded {
+			succeeded[d.DeliveryID] = true
+		}
+		if !d.CreatedAt.Before(from) && d.CreatedAt.Before(to) {
+			last[d.DeliveryID] = d
+		}
+	}
+	var res []*entity.WebhookDelivery
+	for id, d := range last {
+		if d.Status == entity.DeliveryStatusFailed && !succeeded[id] {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+var _ usecase.DeliveryLogRepository = (*MockDeliveryLog)(nil)
+
+// MockGeofence хранит состояние геофенсинга в памяти.
+type MockGeofence struct {
+	mu    sync.Mutex
+	State map[string]map[int]*entity.ZoneMembership
+	Err   error // если задана, возвращается при чтении состояния
+}
+
+func (m *MockGeofence) GetMemberships(ctx context.Context, userID string) (map[int]*entity.ZoneMembership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return maps.Clone(m.State[userID]), nil
+}
+func (m *MockGeofence) SetMemberships(ctx context.Context, userID string, memberships map[int]*entity.ZoneMembership) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.State == nil {
+		m.State = make(map[string]map[int]*entity.ZoneMembership)
+	}
+	m.State[userID] = memberships
+	return nil
+}
 
 type MockPinger struct{}
 
@@ -113,6 +593,11 @@ func (m *MockPinger) Ping(ctx context.Context) error { return nil }
 // --- Вспомогательные функции ---
 
 func setupHandler() (*gin.Engine, *MockIncidentRepo) {
+	router, repo, _ := setupHandlerWithQueue()
+	return router, repo
+}
+
+func setupHandlerWithQueue() (*gin.Engine, *MockIncidentRepo, *MockQueueRepo) {
 	gin.SetMode(gin.TestMode)
 
 	mockIncRepo := NewMockIncidentRepo()
@@ -123,12 +608,13 @@ func setupHandler() (*gin.Engine, *MockIncidentRepo) {
 
 	incidentService := usecase.NewIncidentService(mockIncRepo, mockCache)
 	geoService := usecase.NewGeoService(mockIncRepo, mockLocRepo, mockQueue, mockCache)
+	webhookService := usecase.NewWebhookService(mockQueue, NewMockSubscriptionRepo(), "")
 
 	apiKey := "test-key"
 	statsWindow := 30
 
-	h := delivery.NewHandler(incidentService, geoService, mockPinger, mockPinger, apiKey, statsWindow)
-	return h.InitRoutes(), mockIncRepo
+	h := delivery.NewHandler(incidentService, geoService, webhookService, mockPinger, mockPinger, apiKey, statsWindow)
+	return h.InitRoutes(), mockIncRepo, mockQueue
 }
 
 // --- Тесты ---
@@ -197,18 +683,55 @@ func TestGetIncidents(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var res []entity.Incident
+	var res entity.Page[entity.Incident]
 	json.Unmarshal(w.Body.Bytes(), &res)
-	if len(res) < 1 {
+	if len(res.Items) < 1 {
 		t.Error("Expected at least 1 incident in response")
 	}
 }
 
+func TestGetIncidents_Filters(t *testing.T) {
+	router, repo := setupHandler()
+
+	req, _ := http.NewRequest("GET", "/api/v1/incidents?bbox=37.5,55.7,37.7,55.8&status=active,draft&severity=danger,evacuate&category=fire&q=gas&created_from=2025-01-01T00:00:00Z&sort=-title&limit=50", nil)
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	f := repo.LastFilter
+	if f.BBox == nil || *f.BBox != (entity.BBox{MinLat: 55.7, MinLon: 37.5, MaxLat: 55.8, MaxLon: 37.7}) {
+		t.Errorf("Unexpected bbox: %+v", f.BBox)
+	}
+	// Репозиторий получает на одну запись больше, чтобы узнать о следующей странице
+	if !slices.Equal(f.Statuses, []string{"active", "draft"}) || f.Query != "gas" || f.Sort != "-title" || f.Limit != 51 {
+		t.Errorf("Unexpected filter: %+v", f)
+	}
+	if !slices.Equal(f.Severities, []string{"danger", "evacuate"}) || !slices.Equal(f.Categories, []string{"fire"}) {
+		t.Errorf("Unexpected severity/category filter: %v %v", f.Severities, f.Categories)
+	}
+	if f.CreatedFrom == nil || !f.CreatedFrom.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) || f.CreatedTo != nil {
+		t.Errorf("Unexpected created range: %v - %v", f.CreatedFrom, f.CreatedTo)
+	}
+
+	for _, query := range []string{"bbox=1,2,3", "bbox=0,100,1,101", "status=unknown", "severity=high", "category=fire,alien", "sort=radius", "created_to=yesterday", "sort=title&cursor=" + (entity.Cursor{Time: time.Now(), ID: 1}).Encode()} {
+		req, _ := http.NewRequest("GET", "/api/v1/incidents?"+query, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
 func TestCheckLocation(t *testing.T) {
 	router, repo := setupHandler()
 
 	// Инцидент в координатах 10,10 с радиусом 1000м (~1км)
-	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000}
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
 
 	body := []byte(`{"user_id":"u1","latitude":10.001,"longitude":10.001}`)
 	req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
@@ -227,3 +750,1407 @@ func TestCheckLocation(t *testing.T) {
 		t.Errorf("Expected 1 match, got %d", len(matches))
 	}
 }
+
+func TestCreateIncident_InvalidGeometry(t *testing.T) {
+	router, repo := setupHandler()
+
+	// Контур не замкнут
+	body := []byte(`{"title":"Flood","geometry":{"type":"Polygon","coordinates":[[[37.0,55.0],[37.1,55.0],[37.1,55.1],[37.0,55.1]]]}}`)
+	req, _ := http.NewRequest("POST", "/api/v1/incidents", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if len(repo.Incidents) != 0 {
+		t.Errorf("Expected no incidents in repo, got %d", len(repo.Incidents))
+	}
+}
+
+func TestCheckLocation_PolygonWithHole(t *testing.T) {
+	router, repo := setupHandler()
+
+	// Квадрат 10..10.1 с отверстием 10.04..10.06
+	body := []byte(`{"title":"Construction site","geometry":{"type":"Polygon","coordinates":[
+		[[10.0,10.0],[10.1,10.0],[10.1,10.1],[10.0,10.1],[10.0,10.0]],
+		[[10.04,10.04],[10.06,10.04],[10.06,10.06],[10.04,10.06],[10.04,10.04]]
+	]}}`)
+	req, _ := http.NewRequest("POST", "/api/v1/incidents", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if inc := repo.Incidents[1]; inc.Latitude != 10.05 || inc.Longitude != 10.05 {
+		t.Errorf("Expected polygon center 10.05,10.05, got %v,%v", inc.Latitude, inc.Longitude)
+	}
+
+	cases := []struct {
+		lat, lon float64
+		want     int
+	}{
+		{10.02, 10.02, 1}, // внутри полигона
+		{10.05, 10.05, 0}, // в отверстии
+		{10.2, 10.2, 0},   // снаружи
+	}
+	for _, tc := range cases {
+		body := []byte(fmt.Sprintf(`{"user_id":"u1","latitude":%v,"longitude":%v}`, tc.lat, tc.lon))
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var matches []entity.Incident
+		json.Unmarshal(w.Body.Bytes(), &matches)
+		if len(matches) != tc.want {
+			t.Errorf("Point %v,%v: expected %d matches, got %d", tc.lat, tc.lon, tc.want, len(matches))
+		}
+	}
+}
+
+func TestImportGeoJSON(t *testing.T) {
+	router, repo := setupHandler()
+
+	body := []byte(`{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[37.0,55.0]},"properties":{"title":"Gas","radius_meters":200}},
+		{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[37.0,55.0],[37.1,55.0],[37.1,55.1],[37.0,55.0]]]},"properties":{"title":"Flood"}}
+	]}`)
+	req, _ := http.NewRequest("POST", "/api/v1/incidents/import", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if len(repo.Incidents) != 2 {
+		t.Fatalf("Expected 2 incidents in repo, got %d", len(repo.Incidents))
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/incidents/geojson", nil)
+	req.Header.Set("X-API-Key", "test-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var fc delivery.FeatureCollection
+	json.Unmarshal(w.Body.Bytes(), &fc)
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Errorf("Expected FeatureCollection with 2 features, got %s", w.Body.String())
+	}
+}
+
+func TestImportGeoJSON_PerFeatureErrors(t *testing.T) {
+	router, repo := setupHandler()
+
+	body := []byte(`{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[37.0,55.0]},"properties":{"title":"Gas","radius_meters":200}},
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[37.0,55.0]},"properties":{"title":"No radius"}}
+	]}`)
+	req, _ := http.NewRequest("POST", "/api/v1/incidents/import", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var res struct {
+		Errors []delivery.ImportFeatureError `json:"errors"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if len(res.Errors) != 1 || res.Errors[0].Index != 1 {
+		t.Errorf("Expected a single error for feature 1, got %+v", res.Errors)
+	}
+	if len(repo.Incidents) != 0 {
+		t.Errorf("Expected no incidents to be created, got %d", len(repo.Incidents))
+	}
+}
+
+// MockSpatialIncidentRepo имитирует PostGIS: сопоставление точки с зонами выполняется «на стороне БД».
+type MockSpatialIncidentRepo struct {
+	*MockIncidentRepo
+	Calls int
+}
+
+func (m *MockSpatialIncidentRepo) FindContaining(ctx context.Context, lat, lon float64) ([]*entity.Incident, error) {
+	m.Calls++
+	var res []*entity.Incident
+	for _, i := range m.Incidents {
+		if i.Geometry == nil && lat == i.Latitude && lon == i.Longitude {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+func TestCheckLocation_PushDownOnColdCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := &MockSpatialIncidentRepo{MockIncidentRepo: NewMockIncidentRepo()}
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+	req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var matches []entity.Incident
+	json.Unmarshal(w.Body.Bytes(), &matches)
+	if len(matches) != 1 {
+		t.Errorf("Expected 1 match, got %d", len(matches))
+	}
+	if repo.Calls != 1 {
+		t.Errorf("Expected matching to be pushed down to the repository, got %d calls", repo.Calls)
+	}
+}
+
+func TestIncidentLifecycle_Expiry(t *testing.T) {
+	router, repo := setupHandler()
+
+	past := time.Now().Add(-time.Minute)
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Expired", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000,
+		Status: entity.IncidentStatusActive, ExpiresAt: &past}
+
+	body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+	req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var matches []entity.Incident
+	json.Unmarshal(w.Body.Bytes(), &matches)
+	if len(matches) != 0 {
+		t.Errorf("Expected expired incident not to match, got %d matches", len(matches))
+	}
+
+	service := usecase.NewIncidentService(repo, &MockCache{})
+	n, err := service.ResolveExpired(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 resolved incident, got %d (err: %v)", n, err)
+	}
+	if repo.Incidents[1].Status != entity.IncidentStatusResolved {
+		t.Errorf("Expected status resolved, got %s", repo.Incidents[1].Status)
+	}
+	if events := repo.Events(); len(events) != 1 || events[0].Event != entity.EventIncidentResolved || events[0].IncidentID != 1 {
+		t.Errorf("Expected a single incident_resolved event in the outbox, got %+v", events)
+	}
+}
+
+func TestUpdateIncident_KeepsStatusWhenOmitted(t *testing.T) {
+	router, repo := setupHandler()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Fire", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000,
+		Status: entity.IncidentStatusResolved}
+
+	put := func(body string) {
+		req, _ := http.NewRequest("PUT", "/api/v1/incidents/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+	}
+
+	put(`{"title":"Fire (final report)","latitude":10.0,"longitude":10.0,"radius_meters":1000}`)
+	if status := repo.Incidents[1].Status; status != entity.IncidentStatusResolved {
+		t.Errorf("Expected omitted status to keep resolved, got %s", status)
+	}
+
+	put(`{"title":"Fire","latitude":10.0,"longitude":10.0,"radius_meters":1000,"status":"active"}`)
+	if status := repo.Incidents[1].Status; status != entity.IncidentStatusActive {
+		t.Errorf("Expected explicit status to be applied, got %s", status)
+	}
+}
+
+func TestCheckLocation_ScheduledIncidentStarts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := NewMockIncidentRepo()
+	startsAt := time.Now().Add(100 * time.Millisecond)
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Planned works", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000,
+		Status: entity.IncidentStatusActive, StartsAt: &startsAt}
+
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	geoService.IndexRefreshInterval = time.Hour // начало действия не сопровождается инвалидацией
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	check := func() int {
+		body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var matches []entity.Incident
+		json.Unmarshal(w.Body.Bytes(), &matches)
+		return len(matches)
+	}
+
+	if n := check(); n != 0 {
+		t.Fatalf("Expected scheduled incident not to match before starts_at, got %d", n)
+	}
+	time.Sleep(time.Until(startsAt))
+	if n := check(); n != 1 {
+		t.Errorf("Expected scheduled incident to match once started without rebuilding the index, got %d", n)
+	}
+}
+
+func TestIncidentRevisions_HistoryAndRestore(t *testing.T) {
+	router, repo := setupHandler()
+
+	do := func(method, url, body, operator string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		if operator != "" {
+			req.Header.Set("X-Operator", operator)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	do("POST", "/api/v1/incidents", `{"title":"Fire","latitude":55.0,"longitude":37.0,"radius_meters":500}`, "alice")
+	do("PUT", "/api/v1/incidents/1", `{"title":"Big fire","latitude":55.0,"longitude":37.0,"radius_meters":900}`, "bob")
+	if w := do("DELETE", "/api/v1/incidents/1", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 on delete, got %d", w.Code)
+	}
+
+	w := do("GET", "/api/v1/incidents/1/revisions", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var revisions []entity.IncidentRevision
+	json.Unmarshal(w.Body.Bytes(), &revisions)
+	want := []struct{ action, operator string }{{"created", "alice"}, {"updated", "bob"}, {"deleted", ""}}
+	if len(revisions) != len(want) {
+		t.Fatalf("Expected %d revisions, got %d", len(want), len(revisions))
+	}
+	for k, rev := range revisions {
+		if rev.Revision != k+1 || rev.Action != want[k].action || rev.Actor != "api-key" || rev.Operator != want[k].operator {
+			t.Errorf("Revision %d: unexpected %+v", k+1, rev)
+		}
+	}
+
+	// Восстановление первой ревизии возвращает удаленный инцидент в исходном виде
+	w = do("POST", "/api/v1/incidents/1/revisions/1/restore", "", "carol")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 on restore, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if i := repo.Incidents[1]; i == nil || i.Title != "Fire" || i.RadiusMeters != 500 {
+		t.Errorf("Expected incident restored to revision 1, got %+v", i)
+	}
+	if last := repo.Revisions[len(repo.Revisions)-1]; last.Action != entity.RevisionActionRestored || last.Operator != "carol" || last.Revision != 4 {
+		t.Errorf("Expected restore to be recorded as revision 4 by carol, got %+v", last)
+	}
+
+	if w := do("POST", "/api/v1/incidents/1/revisions/9/restore", "", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected error for unknown revision, got %d", w.Code)
+	}
+}
+
+func TestIncidentRevisions_ActorFromAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), nil, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	h.APIKeys = map[string]string{"dispatch": "dispatch-key"}
+	router := h.InitRoutes()
+
+	create := func(key string) int {
+		req, _ := http.NewRequest("POST", "/api/v1/incidents", bytes.NewBufferString(`{"title":"Fire","latitude":55.0,"longitude":37.0,"radius_meters":500}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Operator", "admin")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := create("dispatch-key"); code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a named key, got %d", code)
+	}
+	if code := create("unknown-key"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with an unknown key, got %d", code)
+	}
+	if len(repo.Revisions) != 1 {
+		t.Fatalf("Expected 1 revision, got %d", len(repo.Revisions))
+	}
+	// X-Operator не подменяет автора: им остается имя ключа
+	if rev := repo.Revisions[0]; rev.Actor != "dispatch" || rev.Operator != "admin" {
+		t.Errorf("Expected actor from the key and claimed operator kept separately, got actor %q operator %q", rev.Actor, rev.Operator)
+	}
+}
+
+func TestIncidentLifecycleEvents(t *testing.T) {
+	router, repo, queue := setupHandlerWithQueue()
+
+	do := func(method, url, body string) {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		req.Header.Set("X-Operator", "alice")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200, got %d. Body: %s", method, url, w.Code, w.Body.String())
+		}
+	}
+
+	do("POST", "/api/v1/incidents", `{"title":"Fire","latitude":55.0,"longitude":37.0,"radius_meters":500,"category":"fire"}`)
+	do("PUT", "/api/v1/incidents/1", `{"title":"Fire","latitude":55.01,"longitude":37.0,"radius_meters":900,"category":"fire"}`)
+	do("DELETE", "/api/v1/incidents/1", "")
+
+	if len(queue.Enqueued) != 0 {
+		t.Errorf("Expected lifecycle events to go through the outbox, got %d direct enqueues", len(queue.Enqueued))
+	}
+	events := repo.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 lifecycle events, got %d", len(events))
+	}
+	created := events[0]
+	if created.Event != entity.EventIncidentCreated || created.Before != nil || created.After == nil || created.Actor != "api-key" || created.Operator != "alice" ||
+		created.IncidentCategory != "fire" || created.IncidentSeverity != entity.SeverityDanger {
+		t.Errorf("Unexpected incident_created event: %+v", created)
+	}
+	updated := events[1]
+	if updated.Event != entity.EventIncidentUpdated || updated.Before == nil || updated.After == nil ||
+		updated.Before.RadiusMeters != 500 || updated.After.RadiusMeters != 900 || updated.After.Latitude != 55.01 {
+		t.Errorf("Unexpected incident_updated event: %+v", updated)
+	}
+	if updated.IncidentRadiusMeters != 900 {
+		t.Errorf("Expected event zone to be the updated one, got radius %d", updated.IncidentRadiusMeters)
+	}
+	deleted := events[2]
+	if deleted.Event != entity.EventIncidentDeleted || deleted.Before == nil || deleted.After != nil || deleted.IncidentID != 1 {
+		t.Errorf("Unexpected incident_deleted event: %+v", deleted)
+	}
+}
+
+func TestCreateIncident_NotifiesUsersAlreadyInside(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	queue := &MockQueueRepo{}
+	now := time.Now()
+	locations := &MockLocationRepo{Checks: []*entity.LocationCheck{
+		{ID: 1, UserID: "inside", Latitude: 10.0, Longitude: 10.0, CheckedAt: now.Add(-time.Minute)},
+		{ID: 2, UserID: "moved-in", Latitude: 20.0, Longitude: 20.0, CheckedAt: now.Add(-3 * time.Minute)},
+		{ID: 3, UserID: "moved-in", Latitude: 10.001, Longitude: 10.0, CheckedAt: now.Add(-2 * time.Minute)},
+		{ID: 4, UserID: "moved-out", Latitude: 10.0, Longitude: 10.0, CheckedAt: now.Add(-3 * time.Minute)},
+		{ID: 5, UserID: "moved-out", Latitude: 20.0, Longitude: 20.0, CheckedAt: now.Add(-2 * time.Minute)},
+		{ID: 6, UserID: "stale", Latitude: 10.0, Longitude: 10.0, CheckedAt: now.Add(-time.Hour)},
+		{ID: 7, UserID: "near", Latitude: 10.015, Longitude: 10.0, CheckedAt: now.Add(-time.Minute)}, // ~1.7 км к северу
+	}}
+	incidentService := usecase.NewIncidentService(repo, &MockCache{})
+	incidentService.LastLocations = locations
+	incidentService.LastLocationMaxAge = 15 * time.Minute
+	incidentService.Outbox = locations
+	h := delivery.NewHandler(incidentService, nil, usecase.NewWebhookService(queue, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	do := func(method, url, body string) {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200, got %d. Body: %s", method, url, w.Code, w.Body.String())
+		}
+	}
+	detected := func() []string {
+		var users []string
+		for _, m := range locations.Outbox {
+			var e entity.WebhookEvent
+			json.Unmarshal(m.Payload, &e)
+			if e.Event == entity.EventDangerZoneDetected {
+				users = append(users, e.UserID)
+			}
+		}
+		for _, p := range queue.Enqueued {
+			if e := p.(entity.WebhookEvent); e.Event == entity.EventDangerZoneDetected {
+				t.Errorf("Expected notification for %s to go through the outbox, got direct enqueue", e.UserID)
+			}
+		}
+		locations.Outbox, queue.Enqueued = nil, nil
+		return users
+	}
+
+	do("POST", "/api/v1/incidents", `{"title":"Fire","latitude":10.0,"longitude":10.0,"radius_meters":1000}`)
+	if users := detected(); !slices.Equal(users, []string{"inside", "moved-in"}) {
+		t.Errorf("Expected users inside the new zone to be notified, got %v", users)
+	}
+
+	// Расширение зоны оповещает только тех, кто оказался внутри впервые
+	do("PUT", "/api/v1/incidents/1", `{"title":"Fire","latitude":10.0,"longitude":10.0,"radius_meters":2000}`)
+	if users := detected(); !slices.Equal(users, []string{"near"}) {
+		t.Errorf("Expected only newly covered user to be notified, got %v", users)
+	}
+
+	// Черновик не оповещает никого
+	do("POST", "/api/v1/incidents", `{"title":"Draft","latitude":10.0,"longitude":10.0,"radius_meters":1000,"status":"draft"}`)
+	if users := detected(); len(users) != 0 {
+		t.Errorf("Expected no notifications for a draft incident, got %v", users)
+	}
+}
+
+func TestCreateIncident_NotifiesUsersInsideWithGeofence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	locations := &MockLocationRepo{Checks: []*entity.LocationCheck{
+		{ID: 1, UserID: "inside", Latitude: 10.0, Longitude: 10.0, CheckedAt: time.Now().Add(-time.Minute)},
+	}}
+	geofence := &MockGeofence{}
+
+	incidentService := usecase.NewIncidentService(repo, &MockCache{})
+	incidentService.LastLocations = locations
+	incidentService.LastLocationMaxAge = 15 * time.Minute
+	incidentService.Outbox = locations
+	incidentService.Geofence = geofence
+	geoService := usecase.NewGeoService(repo, locations, &MockQueueRepo{}, &MockCache{})
+	geoService.Geofence = geofence
+	h := delivery.NewHandler(incidentService, geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	do := func(path, body string, apiKey bool) {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey {
+			req.Header.Set("X-API-Key", "test-key")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s: expected status 200, got %d. Body: %s", path, w.Code, w.Body.String())
+		}
+	}
+	events := func() []string {
+		var got []string
+		for _, m := range locations.Outbox {
+			var e entity.WebhookEvent
+			json.Unmarshal(m.Payload, &e)
+			got = append(got, e.UserID+":"+e.Event)
+		}
+		locations.Outbox = nil
+		return got
+	}
+
+	do("/api/v1/incidents", `{"title":"Fire","latitude":10.0,"longitude":10.0,"radius_meters":1000}`, true)
+	if got := events(); !slices.Equal(got, []string{"inside:zone_entered"}) {
+		t.Fatalf("Expected zone_entered for the user inside, got %v", got)
+	}
+	if m := geofence.State["inside"][1]; m == nil || m.Approaching {
+		t.Fatalf("Expected entry to be recorded in geofence state, got %+v", geofence.State)
+	}
+
+	// Следующая проверка из той же точки не повторяет вход
+	do("/api/v1/location/check", `{"user_id":"inside","latitude":10.0,"longitude":10.0}`, false)
+	if got := events(); len(got) != 0 {
+		t.Errorf("Expected no duplicate zone_entered after the check, got %v", got)
+	}
+}
+
+func TestCheckLocation_SeesNewIncidentAfterInvalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := NewMockIncidentRepo()
+	cache := &MockCache{}
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, cache)
+	geoService.IndexRefreshInterval = time.Hour // без инвалидации индекс не перестроился бы
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, cache), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go geoService.WatchInvalidations(ctx)
+
+	check := func() int {
+		body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var matches []entity.Incident
+		json.Unmarshal(w.Body.Bytes(), &matches)
+		return len(matches)
+	}
+
+	if n := check(); n != 0 {
+		t.Fatalf("Expected no matches before incident is created, got %d", n)
+	}
+
+	body := []byte(`{"title":"Fire","latitude":10.0,"longitude":10.0,"radius_meters":500}`)
+	req, _ := http.NewRequest("POST", "/api/v1/incidents", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	deadline := time.Now().Add(time.Second)
+	for check() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("New incident is not visible to CheckLocation after invalidation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckLocation_InvalidationDuringLoad(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := NewMockIncidentRepo()
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	geoService.IndexRefreshInterval = time.Hour
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	// Инцидент создан, пока первая проверка читала список из БД: уведомление пришло до построения индекса
+	repo.AfterGetActive = func() {
+		repo.AfterGetActive = nil
+		repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Fire", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 500, Status: entity.IncidentStatusActive}
+		geoService.InvalidateIndex()
+	}
+
+	check := func() int {
+		body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var matches []entity.Incident
+		json.Unmarshal(w.Body.Bytes(), &matches)
+		return len(matches)
+	}
+
+	if n := check(); n != 0 {
+		t.Fatalf("Expected no matches from the list loaded before the change, got %d", n)
+	}
+	// Индекс, построенный по устаревшему списку, не должен переиспользоваться
+	if n := check(); n != 1 {
+		t.Errorf("Expected new incident to be visible after invalidation during load, got %d matches", n)
+	}
+}
+
+func TestCheckLocation_StaleIndexRefreshedInBackground(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Fire", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 500, Status: entity.IncidentStatusActive}
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	geoService.IndexRefreshInterval = 20 * time.Millisecond
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	check := func() int {
+		body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var matches []entity.Incident
+		json.Unmarshal(w.Body.Bytes(), &matches)
+		return len(matches)
+	}
+
+	if n := check(); n != 1 {
+		t.Fatalf("Expected 1 match, got %d", n)
+	}
+
+	// Перестройка устаревшего индекса зависает на чтении из БД
+	release := make(chan struct{})
+	defer close(release)
+	repo.AfterGetActive = func() { <-release }
+	time.Sleep(2 * geoService.IndexRefreshInterval)
+
+	done := make(chan int, 1)
+	go func() { done <- check() }()
+	select {
+	case n := <-done:
+		if n != 1 {
+			t.Errorf("Expected stale index to be served, got %d matches", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected check not to wait for the index rebuild")
+	}
+}
+
+func TestDeadLetters_ListAndReplay(t *testing.T) {
+	router, _, queue := setupHandlerWithQueue()
+	queue.DeadLetter(context.Background(), "webhook_tasks", &entity.QueueTask{ID: "1-0", Payload: `{"event":"zone_entered"}`}, "server returned status: 500")
+
+	req, _ := http.NewRequest("GET", "/api/v1/webhooks/dead-letters", nil)
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var letters []entity.DeadLetter
+	json.Unmarshal(w.Body.Bytes(), &letters)
+	if w.Code != http.StatusOK || len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d (status %d)", len(letters), w.Code)
+	}
+
+	for _, limit := range []string{"abc", "0", "-1", "100000"} {
+		req, _ := http.NewRequest("GET", "/api/v1/webhooks/dead-letters?limit="+limit, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for limit=%s, got %d", limit, w.Code)
+		}
+	}
+
+	req, _ = http.NewRequest("POST", "/api/v1/webhooks/dead-letters/1-0/replay", nil)
+	req.Header.Set("X-API-Key", "test-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if len(queue.DeadLetters) != 0 || len(queue.Enqueued) != 1 {
+		t.Errorf("Expected dead letter to be moved back to the queue, got %d dead, %d enqueued", len(queue.DeadLetters), len(queue.Enqueued))
+	}
+}
+
+func TestWebhookSubscriptions_FanOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queue := &MockQueueRepo{}
+	webhookService := usecase.NewWebhookService(queue, NewMockSubscriptionRepo(), "http://default.example")
+	h := delivery.NewHandler(usecase.NewIncidentService(NewMockIncidentRepo(), &MockCache{}), nil, webhookService, &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	create := func(body string) int {
+		req, _ := http.NewRequest("POST", "/api/v1/webhooks/subscriptions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := create(`{"url":"ftp://bad.example"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-http url, got %d", code)
+	}
+	if code := create(`{"url":"http://a.example","event_types":["unknown"]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown event type, got %d", code)
+	}
+	// 1: только входы в зону 7, 2: все события, 3: отключена
+	for _, body := range []string{
+		`{"url":"http://a.example","event_types":["zone_entered"],"incident_ids":[7]}`,
+		`{"url":"http://b.example"}`,
+		`{"url":"http://c.example","active":false}`,
+	} {
+		if code := create(body); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+	}
+
+	tests := []struct {
+		event string
+		want  []int
+	}{
+		{`{"event":"zone_entered","incident_id":7}`, []int{0, 1, 2}},
+		{`{"event":"zone_entered","incident_id":8}`, []int{0, 2}},
+		{`{"event":"zone_exited","incident_id":7}`, []int{0, 2}},
+	}
+	for _, tt := range tests {
+		queue.Enqueued = nil
+		n, err := webhookService.FanOut(context.Background(), tt.event)
+		if err != nil {
+			t.Fatalf("FanOut failed: %v", err)
+		}
+		if n != len(tt.want) || len(queue.Enqueued) != len(tt.want) {
+			t.Fatalf("%s: expected %d deliveries, got %d", tt.event, len(tt.want), n)
+		}
+		for k, id := range tt.want {
+			task := queue.Enqueued[k].(entity.DeliveryTask)
+			if task.SubscriptionID != id {
+				t.Errorf("%s: delivery %d expected subscription %d, got %d", tt.event, k, id, task.SubscriptionID)
+			}
+		}
+	}
+}
+
+func TestWebhookSubscriptions_SeverityCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queue := &MockQueueRepo{}
+	webhookService := usecase.NewWebhookService(queue, NewMockSubscriptionRepo(), "")
+	h := delivery.NewHandler(usecase.NewIncidentService(NewMockIncidentRepo(), &MockCache{}), nil, webhookService, &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	create := func(body string) int {
+		req, _ := http.NewRequest("POST", "/api/v1/webhooks/subscriptions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := create(`{"url":"http://a.example","categories":["alien"]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown category, got %d", code)
+	}
+	if code := create(`{"url":"http://a.example","min_severity":"high"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown severity, got %d", code)
+	}
+	// 1: пожары и химия от уровня danger, 2: только эвакуация
+	for _, body := range []string{
+		`{"url":"http://a.example","categories":["fire","chemical"],"min_severity":"danger"}`,
+		`{"url":"http://b.example","min_severity":"evacuate"}`,
+	} {
+		if code := create(body); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+	}
+
+	tests := []struct {
+		event string
+		want  []int
+	}{
+		{`{"event":"zone_entered","incident_id":1,"incident_severity":"danger","incident_category":"fire"}`, []int{1}},
+		{`{"event":"zone_entered","incident_id":1,"incident_severity":"warning","incident_category":"fire"}`, nil},
+		{`{"event":"zone_entered","incident_id":1,"incident_severity":"evacuate","incident_category":"flood"}`, []int{2}},
+		{`{"event":"zone_entered","incident_id":1,"incident_severity":"evacuate","incident_category":"chemical"}`, []int{1, 2}},
+		// Событие без уровня и категории фильтры по ним не отсекают
+		{`{"event":"zone_exited","incident_id":1}`, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		queue.Enqueued = nil
+		n, err := webhookService.FanOut(context.Background(), tt.event)
+		if err != nil {
+			t.Fatalf("FanOut failed: %v", err)
+		}
+		if n != len(tt.want) {
+			t.Fatalf("%s: expected %d deliveries, got %d", tt.event, len(tt.want), n)
+		}
+		for k, id := range tt.want {
+			if task := queue.Enqueued[k].(entity.DeliveryTask); task.SubscriptionID != id {
+				t.Errorf("%s: delivery %d expected subscription %d, got %d", tt.event, k, id, task.SubscriptionID)
+			}
+		}
+	}
+}
+
+func TestWebhookSubscriptions_RotateSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	subs := NewMockSubscriptionRepo()
+	webhookService := usecase.NewWebhookService(&MockQueueRepo{}, subs, "")
+	h := delivery.NewHandler(usecase.NewIncidentService(NewMockIncidentRepo(), &MockCache{}), nil, webhookService, &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	type secretResponse struct {
+		ID                   int    `json:"id"`
+		Secret               string `json:"secret"`
+		PreviousSecretsCount int    `json:"previous_secrets_count"`
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200, got %d. Body: %s", method, path, w.Code, w.Body.String())
+		}
+		return w
+	}
+	post := func(path, body string) *secretResponse {
+		var resp secretResponse
+		json.Unmarshal(do("POST", path, body).Body.Bytes(), &resp)
+		return &resp
+	}
+
+	// Секрет генерируется, если не задан
+	created := post("/api/v1/webhooks/subscriptions", `{"url":"http://a.example"}`)
+	if created.ID != 1 || created.Secret == "" {
+		t.Fatalf("Expected generated secret in create response, got %+v", created)
+	}
+
+	rotated := post("/api/v1/webhooks/subscriptions/1/rotate-secret", `{"secret":"new-secret"}`)
+	if rotated.Secret != "new-secret" || rotated.PreviousSecretsCount != 1 || subs.Subs[1].PreviousSecrets[0].Secret != created.Secret {
+		t.Errorf("Expected old secret to stay active after rotation, got %+v", rotated)
+	}
+
+	// Обновление не меняет секреты в обход ротации
+	req, _ := http.NewRequest("PUT", "/api/v1/webhooks/subscriptions/1", bytes.NewBufferString(`{"url":"http://a.example","secret":"sneaky"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "rotate-secret") {
+		t.Errorf("Expected 400 pointing to rotate-secret for secret on update, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	do("PUT", "/api/v1/webhooks/subscriptions/1", `{"url":"http://b.example"}`)
+	if sub := subs.Subs[1]; sub.URL != "http://b.example" || sub.Secret != "new-secret" || len(sub.PreviousSecrets) != 1 {
+		t.Errorf("Expected update to keep current and previous secrets, got %+v", sub)
+	}
+
+	// Чтение подписок секретов не раскрывает
+	for _, path := range []string{"/api/v1/webhooks/subscriptions", "/api/v1/webhooks/subscriptions/1"} {
+		if body := do("GET", path, "").Body.String(); strings.Contains(body, "secret") {
+			t.Errorf("GET %s: expected no secrets in response, got %s", path, body)
+		}
+	}
+
+	revoked := post("/api/v1/webhooks/subscriptions/1/rotate-secret", `{"revoke_previous":true}`)
+	if revoked.Secret == "" || revoked.Secret == "new-secret" || revoked.PreviousSecretsCount != 0 {
+		t.Errorf("Expected new generated secret and no previous secrets, got %+v", revoked)
+	}
+
+	// Частые ротации не накапливают секреты бесконечно
+	for range entity.MaxPreviousSecrets + 2 {
+		post("/api/v1/webhooks/subscriptions/1/rotate-secret", "")
+	}
+	if n := len(subs.Subs[1].PreviousSecrets); n != entity.MaxPreviousSecrets {
+		t.Errorf("Expected at most %d previous secrets, got %d", entity.MaxPreviousSecrets, n)
+	}
+
+	// По истечении срока прежний секрет больше не используется для подписи
+	webhookService.SecretGracePeriod = 50 * time.Millisecond
+	post("/api/v1/webhooks/subscriptions/1/rotate-secret", `{"revoke_previous":true}`)
+	graced := post("/api/v1/webhooks/subscriptions/1/rotate-secret", "")
+	if graced.PreviousSecretsCount != 1 || len(subs.Subs[1].SigningSecrets(time.Now())) != 2 {
+		t.Fatalf("Expected previous secret to stay active during grace period, got %+v", graced)
+	}
+	if secrets := subs.Subs[1].SigningSecrets(time.Now().Add(time.Second)); !slices.Equal(secrets, []string{graced.Secret}) {
+		t.Errorf("Expected only the current secret after grace period, got %v", secrets)
+	}
+}
+
+func TestCheckLocation_WritesOutboxWithCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	locations := &MockLocationRepo{}
+	queue := &MockQueueRepo{}
+
+	geoService := usecase.NewGeoService(repo, locations, queue, &MockCache{})
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(queue, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	check := func() int {
+		body := []byte(`{"user_id":"u1","latitude":10.0,"longitude":10.0}`)
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := check(); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	// Проверка, совпадение и событие сохраняются синхронно, а не ставятся в очередь напрямую
+	if len(locations.Checks) != 1 || len(locations.Matches[1]) != 1 || len(locations.Outbox) != 1 {
+		t.Fatalf("Expected check, match and outbox message to be saved, got %d checks, %v matches, %d outbox",
+			len(locations.Checks), locations.Matches, len(locations.Outbox))
+	}
+	var event entity.WebhookEvent
+	json.Unmarshal(locations.Outbox[0].Payload, &event)
+	if locations.Outbox[0].Queue != "webhook_tasks" || event.Event != entity.EventDangerZoneDetected || event.IncidentID != 1 {
+		t.Errorf("Unexpected outbox message: %+v", locations.Outbox[0])
+	}
+	if len(queue.Enqueued) != 0 {
+		t.Errorf("Expected no direct enqueue, got %d", len(queue.Enqueued))
+	}
+
+	// Ошибка сохранения не должна выглядеть как успешная проверка
+	locations.Err = fmt.Errorf("db is down")
+	if code := check(); code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 when check cannot be persisted, got %d", code)
+	}
+}
+
+func TestWebhookDeliveries_LogAndResend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queue := &MockQueueRepo{}
+	deliveries := &MockDeliveryLog{}
+	webhookService := usecase.NewWebhookService(queue, NewMockSubscriptionRepo(), "http://default.example")
+	webhookService.Deliveries = deliveries
+	h := delivery.NewHandler(usecase.NewIncidentService(NewMockIncidentRepo(), &MockCache{}), nil, webhookService, &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+	ctx := context.Background()
+	sub := &entity.WebhookSubscription{URL: "http://default.example", Active: true}
+
+	// Доставка "a": две неудачные попытки; доставка "b": неудача, затем успех
+	taskA := &entity.DeliveryTask{DeliveryID: "a", Event: json.RawMessage(`{"event":"zone_entered","user_id":"u1","incident_id":7}`)}
+	taskB := &entity.DeliveryTask{DeliveryID: "b", Event: json.RawMessage(`{"event":"zone_exited","user_id":"u2","incident_id":8}`)}
+	webhookService.RecordDelivery(ctx, taskA, sub, 1, 500, 20*time.Millisecond, fmt.Errorf("server returned status: 500"))
+	webhookService.RecordDelivery(ctx, taskB, sub, 1, 0, 5*time.Second, fmt.Errorf("timeout"))
+	webhookService.RecordDelivery(ctx, taskA, sub, 2, 503, 30*time.Millisecond, fmt.Errorf("server returned status: 503"))
+	webhookService.RecordDelivery(ctx, taskB, sub, 2, 200, 10*time.Millisecond, nil)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("GET", "/api/v1/webhooks/deliveries?status=failed&incident_id=7", "")
+	var page entity.Page[entity.WebhookDelivery]
+	json.Unmarshal(w.Body.Bytes(), &page)
+	list := page.Items
+	if w.Code != http.StatusOK || len(list) != 2 || page.NextCursor != "" || list[0].Attempt != 2 || list[0].UserID != "u1" || list[0].ResponseStatus != 503 {
+		t.Fatalf("Expected 2 failed attempts of incident 7 (newest first), got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/api/v1/webhooks/deliveries?status=unknown", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown status, got %d", w.Code)
+	}
+
+	// Повторная отправка одной записи
+	if w := do("POST", "/api/v1/webhooks/deliveries/2/resend", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(queue.Enqueued) != 1 || queue.Enqueued[0].(entity.DeliveryTask).DeliveryID != "b" {
+		t.Fatalf("Expected delivery b to be requeued, got %+v", queue.Enqueued)
+	}
+
+	// За период повторно отправляются только так и не доставленные
+	queue.Enqueued = nil
+	from, to := time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	w = do("POST", "/api/v1/webhooks/deliveries/resend", `{"from":"`+from+`","to":"`+to+`"}`)
+	if w.Code != http.StatusOK || len(queue.Enqueued) != 1 {
+		t.Fatalf("Expected 1 requeued delivery, got %d: %s", w.Code, w.Body.String())
+	}
+	task := queue.Enqueued[0].(entity.DeliveryTask)
+	if task.DeliveryID != "a" || task.Attempt != 0 || string(task.Event) != string(taskA.Event) {
+		t.Errorf("Expected delivery a to be resent with fresh attempts, got %+v", task)
+	}
+}
+
+func TestCheckLocationBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	locations := &MockLocationRepo{}
+	geofence := &MockGeofence{}
+
+	geoService := usecase.NewGeoService(repo, locations, &MockQueueRepo{}, &MockCache{})
+	geoService.Geofence = geofence
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	// Точки u1 пришли не по порядку: сначала выход (12:01), затем вход (12:00)
+	body := []byte(`{"points":[
+		{"user_id":"u1","latitude":20.0,"longitude":20.0,"timestamp":"2025-01-01T12:01:00Z"},
+		{"user_id":"u2","latitude":10.0,"longitude":10.0},
+		{"user_id":"u1","latitude":10.0,"longitude":10.0,"timestamp":"2025-01-01T12:00:00Z"}
+	]}`)
+	req, _ := http.NewRequest("POST", "/api/v1/location/check/batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []struct {
+			UserID      string `json:"user_id"`
+			IncidentIDs []int  `json:"incident_ids"`
+		} `json:"results"`
+		Incidents map[string]entity.Incident `json:"incidents"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 3 || len(resp.Results[0].IncidentIDs) != 0 || len(resp.Results[1].IncidentIDs) != 1 || len(resp.Results[2].IncidentIDs) != 1 {
+		t.Fatalf("Unexpected per-point results: %s", w.Body.String())
+	}
+	if resp.Incidents["1"].Title != "Danger Zone" {
+		t.Errorf("Expected matched incident in response, got %+v", resp.Incidents)
+	}
+	if len(locations.Checks) != 3 {
+		t.Fatalf("Expected 3 checks to be saved, got %d", len(locations.Checks))
+	}
+	// checked_at — время получения сервером, время клиента хранится отдельно
+	for n, want := range []string{"2025-01-01T12:01:00Z", "", "2025-01-01T12:00:00Z"} {
+		check := locations.Checks[n]
+		if time.Since(check.CheckedAt) > time.Minute {
+			t.Errorf("Expected check %d to be stamped with server time, got %v", n, check.CheckedAt)
+		}
+		var got string
+		if check.RecordedAt != nil {
+			got = check.RecordedAt.Format(time.RFC3339)
+		}
+		if got != want {
+			t.Errorf("Expected check %d recorded_at %q, got %q", n, want, got)
+		}
+	}
+
+	// События u1 в порядке времени точек, затем вход u2
+	var got []string
+	for _, m := range locations.Outbox {
+		var e entity.WebhookEvent
+		json.Unmarshal(m.Payload, &e)
+		got = append(got, e.UserID+":"+e.Event)
+	}
+	want := []string{"u1:zone_entered", "u1:zone_exited", "u2:zone_entered"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+	if len(geofence.State["u1"]) != 0 || len(geofence.State["u2"]) != 1 {
+		t.Errorf("Unexpected geofence state: %+v", geofence.State)
+	}
+
+	req, _ = http.NewRequest("POST", "/api/v1/location/check/batch", bytes.NewBufferString(`{"points":[{"user_id":"u1","latitude":100,"longitude":0}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for out of range latitude, got %d", w.Code)
+	}
+}
+
+func TestCheckLocation_GeofenceUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	locations := &MockLocationRepo{}
+
+	geoService := usecase.NewGeoService(repo, locations, &MockQueueRepo{}, &MockCache{})
+	geoService.Geofence = &MockGeofence{Err: fmt.Errorf("redis is down")}
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	for _, tc := range []struct{ path, body string }{
+		{"/api/v1/location/check", `{"user_id":"u1","latitude":10.0,"longitude":10.0}`},
+		{"/api/v1/location/check/batch", `{"points":[{"user_id":"u2","latitude":10.0,"longitude":10.0}]}`},
+	} {
+		locations.Outbox = nil
+		req, _ := http.NewRequest("POST", tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d. Body: %s", tc.path, w.Code, w.Body.String())
+		}
+
+		// Без состояния геофенсинга событие не теряется, а уходит как danger_zone_detected
+		if len(locations.Outbox) != 1 {
+			t.Fatalf("%s: expected 1 outbox message, got %d", tc.path, len(locations.Outbox))
+		}
+		var event entity.WebhookEvent
+		json.Unmarshal(locations.Outbox[0].Payload, &event)
+		if event.Event != entity.EventDangerZoneDetected || event.IncidentID != 1 {
+			t.Errorf("%s: expected danger_zone_detected fallback, got %+v", tc.path, event)
+		}
+	}
+}
+
+func TestCheckRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	repo.Incidents[2] = &entity.Incident{ID: 2, Title: "Far Zone", Latitude: 30.0, Longitude: 30.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	for _, body := range []string{
+		`{"geometry":{"type":"LineString","coordinates":[[9.9,10.0],[10.1,10.0]]}}`,
+		`{"points":[{"latitude":10.0,"longitude":9.9},{"latitude":10.0,"longitude":10.1}]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/v1/location/route", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		var resp []usecase.RouteIntersection
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp) != 1 || resp[0].Incident.ID != 1 || len(resp[0].Segments) != 1 {
+			t.Fatalf("Expected one segment in incident 1, got %s", w.Body.String())
+		}
+		// Маршрут проходит через центр окружности: внутри зоны ~2 км
+		if l := resp[0].LengthMeters; l < 1990 || l > 2010 {
+			t.Errorf("Expected ~2000m inside zone, got %.1f", l)
+		}
+	}
+
+	for _, body := range []string{
+		`{"points":[{"latitude":10.0,"longitude":9.9}]}`,
+		`{"geometry":{"type":"Point","coordinates":[[9.9,10.0],[10.1,10.0]]}}`,
+		`{"geometry":{"type":"LineString","coordinates":[[9.9,100.0],[10.1,10.0]]}}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/v1/location/route", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestCheckLocation_ProximityWarnings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Danger Zone", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	locations := &MockLocationRepo{}
+
+	geoService := usecase.NewGeoService(repo, locations, &MockQueueRepo{}, &MockCache{})
+	geoService.Geofence = &MockGeofence{}
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	check := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/location/check", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// ~1.5 км к северу от центра: до границы ~500 м, граница на юге
+	w := check(`{"user_id":"u1","latitude":10.0135,"longitude":10.0,"warning_buffer_meters":1000}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Matches  []entity.Incident          `json:"matches"`
+		Warnings []usecase.ProximityWarning `json:"warnings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Matches) != 0 || len(resp.Warnings) != 1 || resp.Warnings[0].Incident.ID != 1 {
+		t.Fatalf("Expected one warning for incident 1, got %s", w.Body.String())
+	}
+	if d := resp.Warnings[0].DistanceMeters; d < 480 || d > 520 {
+		t.Errorf("Expected ~500m to the edge, got %.1f", d)
+	}
+	if b := resp.Warnings[0].BearingDegrees; math.Abs(b-180) > 1 {
+		t.Errorf("Expected bearing ~180°, got %.1f", b)
+	}
+
+	// Повторная проверка в буфере не порождает события, вход в зону — zone_entered
+	check(`{"user_id":"u1","latitude":10.0135,"longitude":10.0,"warning_buffer_meters":1000}`)
+	check(`{"user_id":"u1","latitude":10.0,"longitude":10.0,"warning_buffer_meters":1000}`)
+
+	var got []string
+	for _, m := range locations.Outbox {
+		var e entity.WebhookEvent
+		json.Unmarshal(m.Payload, &e)
+		got = append(got, e.Event)
+		if e.Event == entity.EventZoneApproaching && e.DistanceMeters == 0 {
+			t.Errorf("Expected distance in zone_approaching event, got %+v", e)
+		}
+	}
+	want := []string{entity.EventZoneApproaching, entity.EventZoneEntered}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+
+	if w := check(`{"user_id":"u1","latitude":10.0,"longitude":10.0,"warning_buffer_meters":-1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative buffer, got %d", w.Code)
+	}
+}
+
+func TestGetNearestIncidents(t *testing.T) {
+	router, repo := setupHandler()
+	// Зоны к востоку от точки (10, 10): внутри, ~1.1 км, ~11 км и ~1100 км
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Here", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 500, Status: entity.IncidentStatusActive}
+	repo.Incidents[2] = &entity.Incident{ID: 2, Title: "Near", Latitude: 10.0, Longitude: 10.02, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	repo.Incidents[3] = &entity.Incident{ID: 3, Title: "Town", Latitude: 10.0, Longitude: 10.11, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	repo.Incidents[4] = &entity.Incident{ID: 4, Title: "Far", Latitude: 10.0, Longitude: 20.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	repo.Incidents[5] = &entity.Incident{ID: 5, Title: "Resolved", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusResolved}
+
+	nearest := func(query string) []usecase.NearbyIncident {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/api/v1/incidents/nearest?"+query, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d. Body: %s", query, w.Code, w.Body.String())
+		}
+		var resp []usecase.NearbyIncident
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	ids := func(res []usecase.NearbyIncident) []int {
+		var ids []int
+		for _, r := range res {
+			ids = append(ids, r.Incident.ID)
+		}
+		return ids
+	}
+
+	// K ближайших: радиус поиска расширяется до дальней зоны
+	res := nearest("lat=10&lon=10&limit=4")
+	if got := ids(res); !slices.Equal(got, []int{1, 2, 3, 4}) {
+		t.Fatalf("Expected incidents [1 2 3 4] by distance, got %v", got)
+	}
+	if res[0].DistanceMeters != 0 || res[1].DistanceMeters < 1000 || res[1].DistanceMeters > 1200 {
+		t.Errorf("Unexpected distances: %v, %v", res[0].DistanceMeters, res[1].DistanceMeters)
+	}
+
+	if got := ids(nearest("lat=10&lon=10&limit=2")); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("Expected incidents [1 2], got %v", got)
+	}
+	// Все в пределах расстояния
+	if got := ids(nearest("lat=10&lon=10&radius_meters=20000")); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("Expected incidents [1 2 3] within 20km, got %v", got)
+	}
+
+	for _, query := range []string{"lat=10", "lat=100&lon=10", "lat=10&lon=10&limit=0", "lat=10&lon=10&radius_meters=-5"} {
+		req, _ := http.NewRequest("GET", "/api/v1/incidents/nearest?"+query, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetLocationChecks_CursorPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	locations := &MockLocationRepo{Matches: map[int][]int{2: {7}}}
+	for n := 1; n <= 5; n++ {
+		// Проверки 3 и 4 сделаны в одну и ту же секунду: порядок внутри секунды задает ID
+		at := start.Add(time.Duration(min(n, 3)) * time.Second)
+		if n == 5 {
+			at = start.Add(4 * time.Second)
+		}
+		locations.Checks = append(locations.Checks, &entity.LocationCheck{ID: n, UserID: "u1", CheckedAt: at})
+	}
+
+	geoService := usecase.NewGeoService(repo, locations, &MockQueueRepo{}, &MockCache{})
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	get := func(query string) (*httptest.ResponseRecorder, entity.Page[entity.LocationCheck]) {
+		req, _ := http.NewRequest("GET", "/api/v1/location/checks?"+query, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var page entity.Page[entity.LocationCheck]
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return w, page
+	}
+
+	var got []int
+	w, page := get("user_id=u1&limit=2")
+	for {
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		for _, c := range page.Items {
+			got = append(got, c.ID)
+			if c.ID == 2 && !slices.Equal(c.IncidentIDs, []int{7}) {
+				t.Errorf("Expected matched incidents of check 2, got %v", c.IncidentIDs)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		// Новая проверка между страницами не сдвигает выборку
+		locations.SaveLocationCheck(context.Background(), &entity.LocationCheck{UserID: "u1"}, nil, nil)
+		w, page = get("user_id=u1&limit=2&cursor=" + page.NextCursor)
+	}
+	if want := []int{5, 4, 3, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("Expected checks %v across pages, got %v", want, got)
+	}
+
+	for _, query := range []string{"cursor=garbage", "limit=0", "from=yesterday"} {
+		if w, _ := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetUsersNearby(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewMockIncidentRepo()
+	repo.Incidents[1] = &entity.Incident{ID: 1, Title: "Fire", Latitude: 10.0, Longitude: 10.0, RadiusMeters: 1000, Status: entity.IncidentStatusActive}
+	store := &MockLastLocationStore{}
+	geoService := usecase.NewGeoService(repo, &MockLocationRepo{}, &MockQueueRepo{}, &MockCache{})
+	geoService.LastLocations = store
+	h := delivery.NewHandler(usecase.NewIncidentService(repo, &MockCache{}), geoService, usecase.NewWebhookService(&MockQueueRepo{}, NewMockSubscriptionRepo(), ""), &MockPinger{}, &MockPinger{}, "test-key", 30)
+	router := h.InitRoutes()
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "test-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Проверки обновляют последние местоположения: u1 в зоне, u2 в ~1.2 км от ее границы, u3 далеко
+	for _, body := range []string{
+		`{"user_id":"u1","latitude":10.0,"longitude":10.0}`,
+		`{"user_id":"u2","latitude":10.02,"longitude":10.0}`,
+		`{"user_id":"u3","latitude":11.0,"longitude":11.0}`,
+	} {
+		if w := do("POST", "/api/v1/location/check", body); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+	}
+	// Более старая точка из пакета не перезаписывает последнее местоположение
+	if w := do("POST", "/api/v1/location/check/batch", `{"points":[{"user_id":"u1","latitude":50.0,"longitude":50.0,"timestamp":"2020-01-01T00:00:00Z"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for batch, got %d", w.Code)
+	}
+
+	users := func(query string) []entity.UserLocation {
+		t.Helper()
+		w := do("GET", "/api/v1/location/users/nearby?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d. Body: %s", query, w.Code, w.Body.String())
+		}
+		var resp []entity.UserLocation
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	ids := func(res []entity.UserLocation) []string {
+		var ids []string
+		for _, u := range res {
+			ids = append(ids, u.UserID)
+		}
+		return ids
+	}
+
+	if got := ids(users("lat=10&lon=10&radius_meters=3000")); !slices.Equal(got, []string{"u1", "u2"}) {
+		t.Errorf("Expected users near the point [u1 u2], got %v", got)
+	}
+	near := users("incident_id=1&radius_meters=1500")
+	if got := ids(near); !slices.Equal(got, []string{"u1", "u2"}) {
+		t.Fatalf("Expected users near the zone [u1 u2], got %v", got)
+	}
+	if near[0].DistanceMeters != 0 || math.Abs(near[1].DistanceMeters-1224) > 10 {
+		t.Errorf("Expected distances to the zone edge 0 and ~1224 m, got %.0f and %.0f", near[0].DistanceMeters, near[1].DistanceMeters)
+	}
+	if got := ids(users("incident_id=1&radius_meters=0")); !slices.Equal(got, []string{"u1"}) {
+		t.Errorf("Expected only users inside the zone [u1], got %v", got)
+	}
+
+	for _, query := range []string{"lat=10&lon=10", "lat=100&lon=10&radius_meters=10", "incident_id=x&radius_meters=10", "radius_meters=-1&lat=10&lon=10"} {
+		if w := do("GET", "/api/v1/location/users/nearby?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+
+	geoService.LastLocations = nil
+	if w := do("GET", "/api/v1/location/users/nearby?lat=10&lon=10&radius_meters=10", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without last location store, got %d", w.Code)
+	}
+}
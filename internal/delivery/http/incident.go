@@ -1,11 +1,17 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/paincake00/geocore/internal/entity"
+	"github.com/paincake00/geocore/internal/usecase"
 )
 
 // createIncident обрабатывает запрос на создание нового инцидента.
@@ -16,9 +22,8 @@ func (h *Handler) createIncident(c *gin.Context) {
 		return
 	}
 
-	// Базовая валидация
-	if input.Title == "" || input.Latitude == 0 || input.Longitude == 0 || input.RadiusMeters <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+	if err := validateIncident(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -30,12 +35,103 @@ func (h *Handler) createIncident(c *gin.Context) {
 	c.JSON(http.StatusOK, input)
 }
 
-// getIncidents возвращает список инцидентов с пагинацией.
+// incidentSorts допустимые значения параметра sort списка инцидентов.
+var incidentSorts = []string{entity.IncidentSortCreatedAt, entity.IncidentSortTitle, entity.IncidentSortStatus, entity.IncidentSortExpiresAt}
+
+// incidentStatuses допустимые статусы инцидента.
+var incidentStatuses = []string{entity.IncidentStatusDraft, entity.IncidentStatusActive, entity.IncidentStatusResolved, entity.IncidentStatusArchived}
+
+// parseListQuery разбирает параметр со списком значений через запятую, проверяя каждое по списку допустимых.
+func parseListQuery(c *gin.Context, name string, allowed []string) ([]string, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	values := strings.Split(v, ",")
+	for _, value := range values {
+		if !slices.Contains(allowed, value) {
+			return nil, fmt.Errorf("invalid %s: %q", name, value)
+		}
+	}
+	return values, nil
+}
+
+// parseSeverityCategory разбирает фильтры по уровню опасности и категории инцидента.
+func parseSeverityCategory(c *gin.Context) ([]string, []string, error) {
+	severities, err := parseListQuery(c, "severity", entity.Severities)
+	if err != nil {
+		return nil, nil, err
+	}
+	categories, err := parseListQuery(c, "category", entity.Categories)
+	if err != nil {
+		return nil, nil, err
+	}
+	return severities, categories, nil
+}
+
+// parseIncidentFilter разбирает параметры выборки списка инцидентов из query-строки.
+func parseIncidentFilter(c *gin.Context) (entity.IncidentFilter, error) {
+	f := entity.IncidentFilter{Query: c.Query("q"), Sort: c.Query("sort")}
+	var err error
+	if f.Limit, f.After, err = parsePage(c, 10); err != nil {
+		return f, err
+	}
+	f.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	// bbox=minLon,minLat,maxLon,maxLat (порядок GeoJSON)
+	if v := c.Query("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return f, errors.New("invalid bbox: expected minLon,minLat,maxLon,maxLat")
+		}
+		var coords [4]float64
+		for n, p := range parts {
+			x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return f, errors.New("invalid bbox: expected minLon,minLat,maxLon,maxLat")
+			}
+			coords[n] = x
+		}
+		b := &entity.BBox{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}
+		if b.MinLat > b.MaxLat || b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 || b.MaxLon < -180 || b.MinLon > 180 {
+			return f, errors.New("invalid bbox: coordinates out of range")
+		}
+		f.BBox = b
+	}
+	for name, dst := range map[string]**time.Time{"created_from": &f.CreatedFrom, "created_to": &f.CreatedTo} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: expected RFC3339 time", name)
+			}
+			*dst = &t
+		}
+	}
+	if f.Statuses, err = parseListQuery(c, "status", incidentStatuses); err != nil {
+		return f, err
+	}
+	if f.Severities, f.Categories, err = parseSeverityCategory(c); err != nil {
+		return f, err
+	}
+	if f.Sort != "" && !slices.Contains(incidentSorts, strings.TrimPrefix(f.Sort, "-")) {
+		return f, fmt.Errorf("invalid sort: %q", f.Sort)
+	}
+	if f.After != nil && !f.KeysetSort() {
+		return f, errors.New("cursor pagination is supported only for created_at sort")
+	}
+	return f, nil
+}
+
+// getIncidents возвращает страницу списка инцидентов с фильтрами (область карты, время создания, статус, текст)
+// и сортировкой: {"items": [...], "next_cursor": "..."}. Фильтрация выполняется в БД.
 func (h *Handler) getIncidents(c *gin.Context) {
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	filter, err := parseIncidentFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	incidents, err := h.IncidentService.GetAll(c.Request.Context(), limit, offset)
+	incidents, err := h.IncidentService.GetAll(c.Request.Context(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -76,6 +172,11 @@ func (h *Handler) updateIncident(c *gin.Context) {
 	}
 	input.ID = id
 
+	if err := validateIncident(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := h.IncidentService.Update(c.Request.Context(), &input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -100,11 +201,56 @@ func (h *Handler) deleteIncident(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
+// getIncidentRevisions возвращает историю изменений инцидента.
+func (h *Handler) getIncidentRevisions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	revisions, err := h.IncidentService.GetRevisions(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if revisions == nil {
+		revisions = []*entity.IncidentRevision{}
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// restoreIncidentRevision возвращает инцидент к состоянию из ревизии.
+func (h *Handler) restoreIncidentRevision(c *gin.Context) {
+	id, errID := strconv.Atoi(c.Param("id"))
+	revision, errRev := strconv.Atoi(c.Param("revision"))
+	if errID != nil || errRev != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	incident, err := h.IncidentService.RestoreRevision(c.Request.Context(), id, revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, incident)
+}
+
 // getStats возвращает статистику по инцидентам (количество уникальных пользователей в зоне).
 func (h *Handler) getStats(c *gin.Context) {
 	window := h.StatsWindow
 
-	stats, err := h.IncidentService.GetStats(c.Request.Context(), window)
+	var filter entity.StatsFilter
+	var err error
+	if filter.Severities, filter.Categories, err = parseSeverityCategory(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := h.IncidentService.GetStats(c.Request.Context(), window, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -122,3 +268,103 @@ func (h *Handler) getStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// maxNearestLimit максимальное количество зон в ответе поиска ближайших.
+const maxNearestLimit = 1000
+
+// getNearestIncidents возвращает ближайшие к точке активные инциденты с расстоянием до них:
+// не более limit и (если задан radius_meters) не дальше radius_meters.
+func (h *Handler) getNearestIncidents(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon are required and must be valid coordinates"})
+		return
+	}
+
+	var radius float64
+	if v := c.Query("radius_meters"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid radius_meters"})
+			return
+		}
+		radius = r
+	}
+
+	// Без limit по радиусу возвращаются все зоны (до maxNearestLimit), без радиуса — 10 ближайших
+	defaultLimit := "10"
+	if radius > 0 {
+		defaultLimit = strconv.Itoa(maxNearestLimit)
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	if err != nil || limit <= 0 || limit > maxNearestLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxNearestLimit)})
+		return
+	}
+
+	nearest, err := h.GeoService.NearestIncidents(c.Request.Context(), lat, lon, limit, radius)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if nearest == nil {
+		nearest = []*usecase.NearbyIncident{}
+	}
+
+	c.JSON(http.StatusOK, nearest)
+}
+
+// validateIncident проверяет входные данные инцидента: зона задается либо окружностью, либо геометрией.
+func validateIncident(i *entity.Incident) error {
+	if i.Title == "" {
+		return errors.New("title is required")
+	}
+	switch i.Status {
+	case "", entity.IncidentStatusDraft, entity.IncidentStatusActive, entity.IncidentStatusResolved, entity.IncidentStatusArchived:
+	default:
+		return fmt.Errorf("invalid status: %q", i.Status)
+	}
+	if i.Severity != "" && entity.SeverityRank(i.Severity) < 0 {
+		return fmt.Errorf("invalid severity: %q", i.Severity)
+	}
+	if i.Category != "" && !slices.Contains(entity.Categories, i.Category) {
+		return fmt.Errorf("invalid category: %q", i.Category)
+	}
+	if i.StartsAt != nil && i.ExpiresAt != nil && !i.ExpiresAt.After(*i.StartsAt) {
+		return errors.New("expires_at must be after starts_at")
+	}
+	if i.Geometry != nil {
+		return validateGeometry(i.Geometry)
+	}
+	if i.Latitude == 0 || i.Longitude == 0 || i.RadiusMeters <= 0 {
+		return errors.New("invalid input")
+	}
+	return nil
+}
+
+// validateGeometry проверяет корректность полигонов: непустые замкнутые контуры и координаты в допустимых диапазонах.
+func validateGeometry(g *entity.Geometry) error {
+	if len(g.Polygons) == 0 {
+		return errors.New("geometry must contain at least one polygon")
+	}
+	for pi, p := range g.Polygons {
+		if len(p) == 0 {
+			return fmt.Errorf("polygon %d has no rings", pi)
+		}
+		for ri, r := range p {
+			if len(r) < 4 {
+				return fmt.Errorf("polygon %d ring %d must have at least 4 positions", pi, ri)
+			}
+			if r[0] != r[len(r)-1] {
+				return fmt.Errorf("polygon %d ring %d is not closed", pi, ri)
+			}
+			for _, pos := range r {
+				if pos.Lon() < -180 || pos.Lon() > 180 || pos.Lat() < -90 || pos.Lat() > 90 {
+					return fmt.Errorf("polygon %d ring %d has out of range position %v", pi, ri, pos)
+				}
+			}
+		}
+	}
+	return nil
+}
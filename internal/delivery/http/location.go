@@ -1,16 +1,27 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
+	"github.com/paincake00/geocore/internal/usecase"
 )
 
+// maxWarningBufferMeters максимальный буфер предупреждения о приближении к зоне.
+const maxWarningBufferMeters = 50000
+
 // CheckLocationInput входные данные для проверки местоположения.
 type CheckLocationInput struct {
 	UserID    string  `json:"user_id" binding:"required"`
 	Latitude  float64 `json:"latitude" binding:"required"`
 	Longitude float64 `json:"longitude" binding:"required"`
+	// WarningBufferMeters если задан, дополнительно возвращаются зоны, до границы которых не больше этого расстояния.
+	WarningBufferMeters float64 `json:"warning_buffer_meters" binding:"gte=0"`
 }
 
 // checkLocation обрабатывает запрос пользователя на проверку нахождения в опасных зонах.
@@ -21,11 +32,245 @@ func (h *Handler) checkLocation(c *gin.Context) {
 		return
 	}
 
-	matches, err := h.GeoService.CheckLocation(c.Request.Context(), input.UserID, input.Latitude, input.Longitude)
+	if input.WarningBufferMeters > maxWarningBufferMeters {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("warning_buffer_meters must be at most %d", maxWarningBufferMeters)})
+		return
+	}
+
+	matches, warnings, err := h.GeoService.CheckLocationWithWarnings(c.Request.Context(), input.UserID, input.Latitude, input.Longitude, input.WarningBufferMeters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Без буфера ответ остается прежним: список зон, в которые попадает точка
+	if input.WarningBufferMeters == 0 {
+		c.JSON(http.StatusOK, matches)
+		return
+	}
+	if matches == nil {
+		matches = []*entity.Incident{}
+	}
+	if warnings == nil {
+		warnings = []*usecase.ProximityWarning{}
+	}
+	c.JSON(http.StatusOK, gin.H{"matches": matches, "warnings": warnings})
+}
+
+// maxBatchPoints максимальное количество точек в одном пакетном запросе.
+const maxBatchPoints = 10000
+
+// LocationPointInput точка пакетной проверки.
+type LocationPointInput struct {
+	UserID    string    `json:"user_id" binding:"required"`
+	Latitude  float64   `json:"latitude" binding:"gte=-90,lte=90"`
+	Longitude float64   `json:"longitude" binding:"gte=-180,lte=180"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BatchCheckLocationInput входные данные пакетной проверки местоположения.
+type BatchCheckLocationInput struct {
+	Points []LocationPointInput `json:"points" binding:"required,min=1,dive"`
+}
+
+// BatchCheckResult результат проверки одной точки: ID совпавших зон (сами зоны — в общем словаре ответа).
+type BatchCheckResult struct {
+	UserID      string    `json:"user_id"`
+	Timestamp   time.Time `json:"timestamp,omitzero"`
+	IncidentIDs []int     `json:"incident_ids"`
+}
+
+// checkLocationBatch проверяет пакет точек (например, от трекера автопарка) по одному снимку инцидентов.
+func (h *Handler) checkLocationBatch(c *gin.Context) {
+	var input BatchCheckLocationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Points) > maxBatchPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many points: %d (max %d)", len(input.Points), maxBatchPoints)})
+		return
+	}
+
+	points := make([]entity.LocationPoint, len(input.Points))
+	for n, p := range input.Points {
+		points[n] = entity.LocationPoint{UserID: p.UserID, Latitude: p.Latitude, Longitude: p.Longitude, Timestamp: p.Timestamp}
+	}
+
+	matches, err := h.GeoService.CheckLocations(c.Request.Context(), points)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, matches)
+	// Зоны повторяются между точками, поэтому отдаем их один раз
+	results := make([]BatchCheckResult, len(points))
+	incidents := make(map[int]*entity.Incident)
+	for n, found := range matches {
+		results[n] = BatchCheckResult{UserID: points[n].UserID, Timestamp: points[n].Timestamp, IncidentIDs: []int{}}
+		for _, i := range found {
+			results[n].IncidentIDs = append(results[n].IncidentIDs, i.ID)
+			incidents[i.ID] = i
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "incidents": incidents})
+}
+
+// maxRoutePoints максимальное количество точек маршрута.
+const maxRoutePoints = 10000
+
+// RoutePointInput точка маршрута в виде объекта.
+type RoutePointInput struct {
+	Latitude  float64 `json:"latitude" binding:"gte=-90,lte=90"`
+	Longitude float64 `json:"longitude" binding:"gte=-180,lte=180"`
+}
+
+// LineStringInput маршрут в формате GeoJSON LineString.
+type LineStringInput struct {
+	Type        string            `json:"type" binding:"required,eq=LineString"`
+	Coordinates []entity.Position `json:"coordinates" binding:"required"`
+}
+
+// CheckRouteInput входные данные проверки маршрута: либо GeoJSON LineString, либо список точек.
+type CheckRouteInput struct {
+	Geometry *LineStringInput  `json:"geometry"`
+	Points   []RoutePointInput `json:"points" binding:"dive"`
+}
+
+// route возвращает точки маршрута в порядке GeoJSON ([lon, lat]).
+func (in CheckRouteInput) route() ([]entity.Position, error) {
+	var route []entity.Position
+	switch {
+	case in.Geometry != nil && len(in.Points) > 0:
+		return nil, errors.New("either geometry or points must be set, not both")
+	case in.Geometry != nil:
+		route = in.Geometry.Coordinates
+	default:
+		for _, p := range in.Points {
+			route = append(route, entity.Position{p.Longitude, p.Latitude})
+		}
+	}
+
+	if len(route) < 2 {
+		return nil, errors.New("route must contain at least 2 points")
+	}
+	if len(route) > maxRoutePoints {
+		return nil, fmt.Errorf("too many points: %d (max %d)", len(route), maxRoutePoints)
+	}
+	for n, pos := range route {
+		if pos.Lon() < -180 || pos.Lon() > 180 || pos.Lat() < -90 || pos.Lat() > 90 {
+			return nil, fmt.Errorf("point %d has out of range position %v", n, pos)
+		}
+	}
+	return route, nil
+}
+
+// checkRoute проверяет, какие опасные зоны пересекает маршрут, с точками входа/выхода и длиной пути внутри зоны.
+func (h *Handler) checkRoute(c *gin.Context) {
+	var input CheckRouteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	route, err := input.route()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	intersections, err := h.GeoService.CheckRoute(c.Request.Context(), route)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if intersections == nil {
+		intersections = []*usecase.RouteIntersection{}
+	}
+
+	c.JSON(http.StatusOK, intersections)
+}
+
+// parseCheckFilter разбирает параметры выборки журнала проверок из query-строки.
+func parseCheckFilter(c *gin.Context) (entity.CheckFilter, error) {
+	f := entity.CheckFilter{UserID: c.Query("user_id")}
+	var err error
+	if f.Limit, f.After, err = parsePage(c, 50); err != nil {
+		return f, err
+	}
+	if v := c.Query("incident_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return f, errors.New("invalid incident_id")
+		}
+		f.IncidentID = &id
+	}
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: expected RFC3339 time", name)
+			}
+			*dst = &t
+		}
+	}
+	return f, nil
+}
+
+// getLocationChecks возвращает страницу журнала проверок местоположения с фильтрами по пользователю, зоне и времени.
+func (h *Handler) getLocationChecks(c *gin.Context) {
+	filter, err := parseCheckFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	checks, err := h.GeoService.GetLocationChecks(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, checks)
+}
+
+// getUsersNearby возвращает пользователей, последнее известное местоположение которых не дальше radius_meters
+// от точки (lat, lon) или от границы зоны инцидента (incident_id), ближайших первыми.
+func (h *Handler) getUsersNearby(c *gin.Context) {
+	radius, err := strconv.ParseFloat(c.Query("radius_meters"), 64)
+	if err != nil || radius < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "radius_meters is required and must be non-negative"})
+		return
+	}
+
+	var users []*entity.UserLocation
+	if v := c.Query("incident_id"); v != "" {
+		id, errID := strconv.Atoi(v)
+		if errID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid incident_id"})
+			return
+		}
+		users, err = h.GeoService.UsersNearIncident(c.Request.Context(), id, radius)
+	} else {
+		lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+		lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+		if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "incident_id or valid lat and lon are required"})
+			return
+		}
+		users, err = h.GeoService.UsersNear(c.Request.Context(), lat, lon, radius)
+	}
+	if errors.Is(err, usecase.ErrLastLocationsDisabled) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if users == nil {
+		users = []*entity.UserLocation{}
+	}
+
+	c.JSON(http.StatusOK, users)
 }
@@ -1,26 +1,48 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
 )
 
-// AuthMiddleware проверяет наличие и валидность API Key в заголовке X-API-Key.
-func AuthMiddleware(apiKey string) gin.HandlerFunc {
+// AuthMiddleware проверяет наличие и валидность API Key в заголовке X-API-Key: общего apiKey
+// или одного из именованных ключей (имя -> ключ).
+// Автор изменений для истории инцидентов — имя ключа, которым выполнен запрос ("api-key" для общего ключа).
+// Заголовок X-Operator не проверяется и сохраняется отдельно как оператор, указанный клиентом.
+func AuthMiddleware(apiKey string, named map[string]string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Если ключ пустой, считаем что авторизация не требуется (для простоты дебага, но небезопасно для прода)
-		if apiKey == "" {
-			c.Next()
+		actor, ok := keyIdentity(c.GetHeader("X-API-Key"), apiKey, named)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		key := c.GetHeader("X-API-Key")
-		if key != apiKey {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
+		ctx := entity.WithActor(c.Request.Context(), actor)
+		if operator := c.GetHeader("X-Operator"); operator != "" {
+			ctx = entity.WithOperator(ctx, operator)
 		}
+		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
 	}
 }
+
+// keyIdentity возвращает имя ключа, совпавшего с переданным. Если ни один ключ не задан, авторизация
+// не требуется (для простоты дебага, но небезопасно для прода), и автор — "anonymous".
+func keyIdentity(key, apiKey string, named map[string]string) (string, bool) {
+	if apiKey == "" && len(named) == 0 {
+		return "anonymous", true
+	}
+	if apiKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+		return "api-key", true
+	}
+	for name, k := range named {
+		if k != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// maxPageLimit максимальный размер страницы списков.
+const maxPageLimit = 1000
+
+// parsePage разбирает параметры страницы: limit (по умолчанию defaultLimit) и непрозрачный курсор cursor,
+// полученный в next_cursor предыдущей страницы.
+func parsePage(c *gin.Context, defaultLimit int) (int, *entity.Cursor, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 || limit > maxPageLimit {
+		return 0, nil, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := entity.ParseCursor(v)
+		if err != nil {
+			return 0, nil, err
+		}
+		return limit, cursor, nil
+	}
+	return limit, nil, nil
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// knownEvents типы событий, на которые можно подписаться.
+var knownEvents = []string{
+	entity.EventDangerZoneDetected,
+	entity.EventZoneEntered,
+	entity.EventZoneExited,
+	entity.EventZoneDwell,
+	entity.EventZoneApproaching,
+	entity.EventIncidentResolved,
+	entity.EventIncidentCreated,
+	entity.EventIncidentUpdated,
+	entity.EventIncidentDeleted,
+}
+
+// subscriptionInput входные данные подписки. Active не указан — подписка включена.
+type subscriptionInput struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	IncidentIDs []int    `json:"incident_ids"`
+	Categories  []string `json:"categories"`
+	MinSeverity string   `json:"min_severity"`
+	Secret      string   `json:"secret"`
+	MaxAttempts int      `json:"max_attempts"`
+	MaxAgeSecs  int      `json:"max_age_seconds"`
+	Active      *bool    `json:"active"`
+}
+
+// toSubscription проверяет входные данные и преобразует их в подписку.
+func (in *subscriptionInput) toSubscription() (*entity.WebhookSubscription, error) {
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http(s) URL")
+	}
+	if in.MaxAttempts < 0 || in.MaxAgeSecs < 0 {
+		return nil, errors.New("max_attempts and max_age_seconds must not be negative")
+	}
+	for _, e := range in.EventTypes {
+		if !slices.Contains(knownEvents, e) {
+			return nil, fmt.Errorf("unknown event type: %q", e)
+		}
+	}
+	for _, category := range in.Categories {
+		if !slices.Contains(entity.Categories, category) {
+			return nil, fmt.Errorf("unknown category: %q", category)
+		}
+	}
+	if in.MinSeverity != "" && entity.SeverityRank(in.MinSeverity) < 0 {
+		return nil, fmt.Errorf("unknown severity: %q", in.MinSeverity)
+	}
+
+	active := true
+	if in.Active != nil {
+		active = *in.Active
+	}
+	return &entity.WebhookSubscription{
+		URL:           in.URL,
+		EventTypes:    in.EventTypes,
+		IncidentIDs:   in.IncidentIDs,
+		Categories:    in.Categories,
+		MinSeverity:   in.MinSeverity,
+		Secret:        in.Secret,
+		MaxAttempts:   in.MaxAttempts,
+		MaxAgeSeconds: in.MaxAgeSecs,
+		Active:        active,
+	}, nil
+}
+
+// subscriptionWithSecret ответ на создание подписки и ротацию секрета — единственные ответы, в которых виден секрет.
+type subscriptionWithSecret struct {
+	*entity.WebhookSubscription
+	Secret               string `json:"secret"`
+	PreviousSecretsCount int    `json:"previous_secrets_count"` // сколько прежних секретов еще действует
+}
+
+// withSecret добавляет к подписке ее текущий секрет для ответа.
+func withSecret(sub *entity.WebhookSubscription) subscriptionWithSecret {
+	previous := sub.ActivePreviousSecrets(time.Now())
+	return subscriptionWithSecret{WebhookSubscription: sub, Secret: sub.Secret, PreviousSecretsCount: len(previous)}
+}
+
+// createSubscription регистрирует нового подписчика вебхуков.
+func (h *Handler) createSubscription(c *gin.Context) {
+	var input subscriptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, err := input.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.WebhookService.CreateSubscription(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Сгенерированный секрет получатель может узнать только из этого ответа
+	c.JSON(http.StatusOK, withSecret(sub))
+}
+
+// getSubscriptions возвращает все подписки.
+func (h *Handler) getSubscriptions(c *gin.Context) {
+	subs, err := h.WebhookService.GetSubscriptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// getSubscription возвращает подписку по ID.
+func (h *Handler) getSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	sub, err := h.WebhookService.GetSubscription(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// updateSubscription обновляет подписку.
+func (h *Handler) updateSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input subscriptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Секрет меняется только ротацией: иначе прежний секрет перестал бы действовать без периода отсрочки
+	if input.Secret != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret cannot be changed on update, use POST /api/v1/webhooks/subscriptions/:id/rotate-secret"})
+		return
+	}
+
+	sub, err := input.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub.ID = id
+
+	if err := h.WebhookService.UpdateSubscription(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// deleteSubscription удаляет подписку.
+func (h *Handler) deleteSubscription(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.WebhookService.DeleteSubscription(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// rotateSecretInput параметры ротации секрета подписки.
+type rotateSecretInput struct {
+	Secret         string `json:"secret"`          // пусто — сгенерировать
+	RevokePrevious bool   `json:"revoke_previous"` // отозвать все предыдущие секреты
+}
+
+// rotateSubscriptionSecret заменяет секрет подписки.
+func (h *Handler) rotateSubscriptionSecret(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input rotateSecretInput
+	// Тело запроса необязательно
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	sub, err := h.WebhookService.RotateSecret(c.Request.Context(), id, input.Secret, input.RevokePrevious)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, withSecret(sub))
+}
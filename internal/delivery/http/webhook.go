@@ -0,0 +1,151 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// getDeadLetters возвращает последние недоставленные вебхуки (не больше limit, курсор не поддерживается).
+func (h *Handler) getDeadLetters(c *gin.Context) {
+	limit, _, err := parsePage(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	letters, err := h.WebhookService.ListDeadLetters(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
+
+// replayDeadLetter возвращает недоставленный вебхук в очередь.
+func (h *Handler) replayDeadLetter(c *gin.Context) {
+	if err := h.WebhookService.ReplayDeadLetter(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "requeued"})
+}
+
+// parseDeliveryFilter разбирает параметры выборки журнала доставок из query-строки.
+func parseDeliveryFilter(c *gin.Context) (entity.DeliveryFilter, error) {
+	f := entity.DeliveryFilter{UserID: c.Query("user_id"), Status: c.Query("status")}
+	var err error
+	if f.Limit, f.After, err = parsePage(c, 50); err != nil {
+		return f, err
+	}
+	f.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	switch f.Status {
+	case "", entity.DeliveryStatusSucceeded, entity.DeliveryStatusFailed:
+	default:
+		return f, fmt.Errorf("invalid status: %q", f.Status)
+	}
+	for name, dst := range map[string]**int{"subscription_id": &f.SubscriptionID, "incident_id": &f.IncidentID} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", name)
+			}
+			*dst = &n
+		}
+	}
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: expected RFC3339 time", name)
+			}
+			*dst = &t
+		}
+	}
+	return f, nil
+}
+
+// getDeliveries возвращает страницу журнала доставок с фильтрами по подписке, инциденту, пользователю, статусу и времени.
+func (h *Handler) getDeliveries(c *gin.Context) {
+	filter, err := parseDeliveryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, err := h.WebhookService.GetDeliveries(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// getDelivery возвращает запись журнала доставок по ID.
+func (h *Handler) getDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	delivery, err := h.WebhookService.GetDelivery(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// resendDelivery повторно отправляет событие из записи журнала.
+func (h *Handler) resendDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.WebhookService.ResendDelivery(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "requeued"})
+}
+
+// resendFailedInput интервал, за который повторно отправляются неудачные доставки.
+type resendFailedInput struct {
+	From           time.Time `json:"from" binding:"required"`
+	To             time.Time `json:"to" binding:"required"`
+	SubscriptionID *int      `json:"subscription_id"`
+}
+
+// resendFailedDeliveries повторно отправляет все неудачные за интервал и так и не доставленные события.
+func (h *Handler) resendFailedDeliveries(c *gin.Context) {
+	var input resendFailedInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.To.After(input.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+
+	n, err := h.WebhookService.ResendFailed(c.Request.Context(), input.From, input.To, input.SubscriptionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "requeued": n})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requeued": n})
+}
@@ -0,0 +1,35 @@
+package entity
+
+import "context"
+
+// ActorSystem автор изменений, выполненных самим сервисом (например, завершение истекших инцидентов).
+const ActorSystem = "system"
+
+type actorKey struct{}
+
+type operatorKey struct{}
+
+// WithActor возвращает контекст с автором изменений для истории инцидентов — именем API-ключа, которым выполнен запрос.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает автора изменений из контекста (ActorSystem, если он не задан).
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
+
+// WithOperator возвращает контекст с оператором, которого указал клиент (заголовок X-Operator).
+// В отличие от автора, оператор не подтверждается аутентификацией и сохраняется только для справки.
+func WithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+// OperatorFromContext возвращает оператора из контекста (пустая строка, если он не указан).
+func OperatorFromContext(ctx context.Context) string {
+	operator, _ := ctx.Value(operatorKey{}).(string)
+	return operator
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor курсор страницы поврежден или получен не от этого API.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor позиция в выборке, упорядоченной по (время, ID): следующая страница начинается сразу после этой записи.
+// Клиентам передается в непрозрачном виде (Encode), поэтому вставка новых записей не сдвигает страницы.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	ID   int64     `json:"id"`
+}
+
+// Encode кодирует курсор в строку для передачи клиенту.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor разбирает курсор, полученный от клиента.
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Time.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Page страница выборки. NextCursor пустой, если следующей страницы нет.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage формирует страницу из выборки, запрошенной с лимитом limit+1: лишняя запись означает,
+// что есть следующая страница, и курсор указывает на последнюю запись страницы.
+func NewPage[T any](items []T, limit int, cursor func(T) Cursor) Page[T] {
+	page := Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if limit > 0 && len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = cursor(items[limit-1]).Encode()
+	}
+	return page
+}
@@ -1,16 +1,117 @@
 package entity
 
-import "time"
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Статусы жизненного цикла инцидента.
+const (
+	IncidentStatusDraft    = "draft"    // черновик, в проверках не участвует
+	IncidentStatusActive   = "active"   // действует в окне [StartsAt, ExpiresAt)
+	IncidentStatusResolved = "resolved" // завершен (вручную или по истечении ExpiresAt)
+	IncidentStatusArchived = "archived" // в архиве
+)
+
+// Уровни опасности инцидента в порядке возрастания.
+const (
+	SeverityInfo     = "info"     // информация
+	SeverityWarning  = "warning"  // предупреждение
+	SeverityDanger   = "danger"   // опасность (по умолчанию)
+	SeverityEvacuate = "evacuate" // требуется эвакуация
+)
+
+// Severities уровни опасности в порядке возрастания.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityDanger, SeverityEvacuate}
+
+// SeverityRank возвращает порядковый номер уровня опасности (-1 для неизвестного).
+func SeverityRank(severity string) int {
+	return slices.Index(Severities, severity)
+}
+
+// Categories категории инцидентов.
+var Categories = []string{"fire", "flood", "chemical", "police", "medical", "weather", "infrastructure", "other"}
+
+// CategoryOther категория по умолчанию.
+const CategoryOther = "other"
 
 // Incident представляет собой опасную зону (событие), создаваемую оператором.
+// Зона задается либо окружностью (Latitude, Longitude, RadiusMeters), либо произвольной геометрией (Geometry).
+// Для полигональных зон Latitude/Longitude содержат центр охватывающего прямоугольника.
 type Incident struct {
-	ID           int       `json:"id"`
-	Title        string    `json:"title"`
-	Description  string    `json:"description"`
-	Latitude     float64   `json:"latitude"`
-	Longitude    float64   `json:"longitude"`
-	RadiusMeters int       `json:"radius_meters"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int        `json:"id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Latitude     float64    `json:"latitude"`
+	Longitude    float64    `json:"longitude"`
+	RadiusMeters int        `json:"radius_meters"`
+	Geometry     *Geometry  `json:"geometry,omitempty"`
+	Status       string     `json:"status"`
+	Severity     string     `json:"severity"`             // уровень опасности (Severities)
+	Category     string     `json:"category"`             // категория (Categories)
+	StartsAt     *time.Time `json:"starts_at,omitempty"`  // начало действия (nil — сразу)
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // окончание действия (nil — бессрочно)
+	CreatedAt    time.Time  `json:"created_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"` // время удаления (удаленные инциденты скрыты, но сохраняются вместе с историей)
+}
+
+// Действия, фиксируемые в истории изменений инцидента.
+const (
+	RevisionActionCreated  = "created"
+	RevisionActionUpdated  = "updated"
+	RevisionActionDeleted  = "deleted"
+	RevisionActionRestored = "restored"
+	RevisionActionExpired  = "expired"
+)
+
+// IncidentRevision запись истории изменений инцидента: состояние после изменения, кто и когда его внес.
+type IncidentRevision struct {
+	ID         int64     `json:"id"`
+	IncidentID int       `json:"incident_id"`
+	Revision   int       `json:"revision"` // порядковый номер в пределах инцидента, начиная с 1
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`              // имя API-ключа, которым выполнено изменение
+	Operator   string    `json:"operator,omitempty"` // оператор из заголовка X-Operator (указан клиентом, не проверяется)
+	Incident   *Incident `json:"incident"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Поля сортировки списка инцидентов (с префиксом "-" — по убыванию).
+const (
+	IncidentSortCreatedAt = "created_at"
+	IncidentSortTitle     = "title"
+	IncidentSortStatus    = "status"
+	IncidentSortExpiresAt = "expires_at"
+)
+
+// BBox прямоугольная область карты. Если MinLon > MaxLon, область пересекает антимеридиан.
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// IncidentFilter параметры выборки списка инцидентов (пустые поля не фильтруют).
+type IncidentFilter struct {
+	BBox                   *BBox // зоны, охватывающий прямоугольник которых пересекает область
+	CreatedFrom, CreatedTo *time.Time
+	Statuses               []string
+	Severities             []string
+	Categories             []string
+	Query                  string  // подстрока в названии или описании (без учета регистра)
+	Sort                   string  // поле сортировки; по умолчанию "-created_at"
+	After                  *Cursor // продолжить выборку после этой записи (только при сортировке по created_at)
+	Limit, Offset          int
+}
+
+// StatsFilter параметры отбора инцидентов для статистики (пустые поля не фильтруют).
+type StatsFilter struct {
+	Severities []string
+	Categories []string
+}
+
+// KeysetSort сообщает, поддерживает ли сортировка постраничный обход по курсору (только по времени создания).
+func (f IncidentFilter) KeysetSort() bool {
+	return f.Sort == "" || f.Sort == IncidentSortCreatedAt || f.Sort == "-"+IncidentSortCreatedAt
 }
 
 // LocationCheck представляет собой факт проверки местоположения пользователем.
@@ -19,16 +120,223 @@ type LocationCheck struct {
 	UserID    string    `json:"user_id"`
 	Latitude  float64   `json:"latitude"`
 	Longitude float64   `json:"longitude"`
-	CheckedAt time.Time `json:"checked_at"`
+	CheckedAt time.Time `json:"checked_at"` // время получения точки сервером
+	// RecordedAt время фиксации точки на устройстве, если клиент его передал (пакетная проверка).
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	// IncidentIDs зоны, в которые попала точка (заполняется при выборке журнала проверок).
+	IncidentIDs []int `json:"incident_ids,omitempty"`
+}
+
+// PointTime возвращает время, к которому относится местоположение: время на устройстве,
+// но не позже получения сервером (часы клиента могут спешить).
+func (c *LocationCheck) PointTime() time.Time {
+	if c.RecordedAt != nil && c.RecordedAt.Before(c.CheckedAt) {
+		return *c.RecordedAt
+	}
+	return c.CheckedAt
+}
+
+// UserLocation последнее известное местоположение пользователя.
+type UserLocation struct {
+	UserID         string    `json:"user_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	SeenAt         time.Time `json:"seen_at"`
+	DistanceMeters float64   `json:"distance_meters"` // до точки поиска или до границы зоны (0 — внутри зоны)
+}
+
+// CheckFilter параметры выборки журнала проверок местоположения (пустые поля не фильтруют).
+type CheckFilter struct {
+	UserID     string
+	IncidentID *int
+	From, To   *time.Time
+	After      *Cursor // продолжить выборку после этой записи
+	Limit      int
+}
+
+// LocationPoint точка пакетной проверки местоположения (например, от трекера автопарка).
+type LocationPoint struct {
+	UserID    string    `json:"user_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Timestamp time.Time `json:"timestamp"` // время фиксации точки (нулевое — время проверки)
+}
+
+// ZoneMembership состояние пребывания пользователя в зоне инцидента (для геофенсинга).
+type ZoneMembership struct {
+	EnteredAt     time.Time `json:"entered_at"`
+	DwellNotified bool      `json:"dwell_notified"`
+	Approaching   bool      `json:"approaching,omitempty"` // пользователь в буфере предупреждения у границы, а не в зоне
 }
 
+// Типы событий, отправляемых во внешние системы.
+const (
+	EventDangerZoneDetected = "danger_zone_detected" // пользователь находится в зоне (без учета состояния)
+	EventZoneEntered        = "zone_entered"         // пользователь вошел в зону
+	EventZoneExited         = "zone_exited"          // пользователь покинул зону
+	EventZoneDwell          = "zone_dwell"           // пользователь находится в зоне дольше порога
+	EventZoneApproaching    = "zone_approaching"     // пользователь приближается к зоне (в буфере предупреждения)
+	EventIncidentResolved   = "incident_resolved"    // инцидент завершен по истечении срока действия
+	EventIncidentCreated    = "incident_created"     // оператор создал инцидент
+	EventIncidentUpdated    = "incident_updated"     // оператор изменил инцидент (зону, статус, описание)
+	EventIncidentDeleted    = "incident_deleted"     // оператор удалил инцидент
+)
+
 // WebhookEvent структура для отправки в очередь Redis и последующей обработки воркером.
 type WebhookEvent struct {
-	Event                string  `json:"event"`
-	UserID               string  `json:"user_id"`
-	IncidentID           int     `json:"incident_id"`
-	IncidentLatitude     float64 `json:"incident_latitude"`
-	IncidentLongitude    float64 `json:"incident_longitude"`
-	IncidentRadiusMeters int     `json:"incident_radius_meters"`
-	DetectedAt           string  `json:"detected_at"`
+	Event                string    `json:"event"`
+	UserID               string    `json:"user_id,omitempty"`
+	IncidentID           int       `json:"incident_id"`
+	IncidentLatitude     float64   `json:"incident_latitude"`
+	IncidentLongitude    float64   `json:"incident_longitude"`
+	IncidentRadiusMeters int       `json:"incident_radius_meters"`
+	IncidentSeverity     string    `json:"incident_severity,omitempty"`
+	IncidentCategory     string    `json:"incident_category,omitempty"`
+	DwellSeconds         int       `json:"dwell_seconds,omitempty"`   // для zone_dwell и zone_exited
+	DistanceMeters       float64   `json:"distance_meters,omitempty"` // для zone_approaching: расстояние до границы зоны
+	BearingDegrees       float64   `json:"bearing_degrees,omitempty"` // для zone_approaching: направление на границу (0° — север)
+	Before               *Incident `json:"before,omitempty"`          // для incident_updated и incident_deleted: инцидент до изменения
+	After                *Incident `json:"after,omitempty"`           // для incident_created и incident_updated: инцидент после изменения
+	Actor                string    `json:"actor,omitempty"`           // автор изменения инцидента (имя API-ключа)
+	Operator             string    `json:"operator,omitempty"`        // оператор, указанный клиентом в X-Operator
+	DetectedAt           string    `json:"detected_at"`
+}
+
+// QueueTask задача, полученная из очереди. Остается за воркером, пока не будет подтверждена (Ack)
+// или перемещена в очередь недоставленных (DeadLetter).
+type QueueTask struct {
+	ID      string // идентификатор сообщения в очереди
+	Payload string // JSON полезной нагрузки
+}
+
+// DeadLetter задача, от которой воркер отказался после всех попыток.
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Queue    string          `json:"queue"`
+	TaskID   string          `json:"task_id"`
+	Payload  json.RawMessage `json:"payload"`
+	Reason   string          `json:"reason"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// WebhookSubscription подписка внешней системы на события с фильтрами.
+// Пустой фильтр означает «все»: все типы событий или все инциденты.
+type WebhookSubscription struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	IncidentIDs []int    `json:"incident_ids"`
+	Categories  []string `json:"categories"`             // категории инцидентов (пусто — все)
+	MinSeverity string   `json:"min_severity,omitempty"` // минимальный уровень опасности (пусто — любой)
+	Secret      string   `json:"-"`                      // не отдается в API, кроме ответов на создание и ротацию
+	// MaxAttempts и MaxAgeSeconds ограничивают повторные попытки доставки (0 — настройки воркера).
+	MaxAttempts   int `json:"max_attempts,omitempty"`
+	MaxAgeSeconds int `json:"max_age_seconds,omitempty"`
+	// PreviousSecrets секреты до ротации (новые первыми): доставки подписываются и ими, пока они не истекли
+	// или их не отозвали. В API не отдаются.
+	PreviousSecrets []PreviousSecret `json:"-"`
+	Active          bool             `json:"active"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
+
+// MaxPreviousSecrets сколько предыдущих секретов подписки может действовать одновременно:
+// при ротации сверх этого числа самые старые отбрасываются.
+const MaxPreviousSecrets = 3
+
+// PreviousSecret секрет подписки до ротации.
+type PreviousSecret struct {
+	Secret    string
+	ExpiresAt time.Time // после этого момента доставки им не подписываются (нулевое время — без срока)
+}
+
+// SigningSecrets возвращает секреты подписки, действующие в момент now: текущий и неистекшие предыдущие.
+func (s *WebhookSubscription) SigningSecrets(now time.Time) []string {
+	secrets := []string{s.Secret}
+	for _, p := range s.ActivePreviousSecrets(now) {
+		secrets = append(secrets, p.Secret)
+	}
+	return secrets
+}
+
+// ActivePreviousSecrets возвращает предыдущие секреты, не истекшие к моменту now.
+func (s *WebhookSubscription) ActivePreviousSecrets(now time.Time) []PreviousSecret {
+	var active []PreviousSecret
+	for _, p := range s.PreviousSecrets {
+		if p.ExpiresAt.IsZero() || p.ExpiresAt.After(now) {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+// RotateSecret делает secret текущим секретом. Прежний секрет действует еще grace, истекшие отбрасываются,
+// а всего предыдущих остается не больше MaxPreviousSecrets. revokePrevious отзывает все предыдущие сразу.
+func (s *WebhookSubscription) RotateSecret(secret string, now time.Time, grace time.Duration, revokePrevious bool) {
+	var previous []PreviousSecret
+	if !revokePrevious {
+		previous = append([]PreviousSecret{{Secret: s.Secret, ExpiresAt: now.Add(grace)}}, s.ActivePreviousSecrets(now)...)
+		if len(previous) > MaxPreviousSecrets {
+			previous = previous[:MaxPreviousSecrets]
+		}
+	}
+	s.Secret, s.PreviousSecrets = secret, previous
+}
+
+// DeliveryTask задача доставки одного события одному подписчику.
+// У каждой доставки собственное состояние повторных попыток.
+type DeliveryTask struct {
+	// DeliveryID объединяет все попытки доставки одного события одному подписчику (в том числе повторные отправки).
+	DeliveryID     string          `json:"delivery_id"`
+	SubscriptionID int             `json:"subscription_id"` // 0 — подписчик по умолчанию (WEBHOOK_URL)
+	Event          json.RawMessage `json:"event"`
+	Attempt        int             `json:"attempt,omitempty"` // количество неудачных попыток
+	CreatedAt      time.Time       `json:"created_at"`        // время рассылки события (для ограничения возраста доставки)
+}
+
+// OutboxMessage задача очереди, сохраненная в PostgreSQL в одной транзакции с данными, которые ее породили.
+// Публикуется в очередь фоновым ретранслятором (transactional outbox).
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	Queue     string          `json:"queue"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OutboxFunc формирует сообщения outbox по записанному инциденту. Хранилище вызывает ее в транзакции изменения
+// и сохраняет сообщения в той же транзакции, поэтому событие не теряется, если изменение зафиксировано.
+type OutboxFunc func(i *Incident) ([]*OutboxMessage, error)
+
+// Статусы попытки доставки вебхука.
+const (
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookDelivery запись журнала доставки: одна попытка отправки события подписчику.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	DeliveryID     string          `json:"delivery_id"`
+	SubscriptionID int             `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Event          string          `json:"event"`
+	IncidentID     int             `json:"incident_id"`
+	UserID         string          `json:"user_id,omitempty"`
+	Attempt        int             `json:"attempt"`
+	RequestBody    json.RawMessage `json:"request_body"`
+	ResponseStatus int             `json:"response_status,omitempty"` // 0 — ответ не получен
+	LatencyMs      int64           `json:"latency_ms"`
+	Error          string          `json:"error,omitempty"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// DeliveryFilter параметры выборки журнала доставок (пустые поля не фильтруют).
+type DeliveryFilter struct {
+	SubscriptionID *int
+	IncidentID     *int
+	UserID         string
+	Status         string
+	From, To       *time.Time
+	After          *Cursor // продолжить выборку после этой записи
+	Limit, Offset  int
 }
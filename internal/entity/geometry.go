@@ -0,0 +1,106 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Типы геометрий, поддерживаемые для зон инцидентов (в терминах GeoJSON).
+const (
+	GeometryPolygon      = "Polygon"
+	GeometryMultiPolygon = "MultiPolygon"
+)
+
+// Position точка в порядке GeoJSON: [долгота, широта].
+type Position [2]float64
+
+// Lon возвращает долготу точки.
+func (p Position) Lon() float64 { return p[0] }
+
+// Lat возвращает широту точки.
+func (p Position) Lat() float64 { return p[1] }
+
+// DistanceMeters вычисляет расстояние между двумя точками в метрах, используя формулу Хаверсина (Haversine).
+// Общая для сервисов и хранилищ, чтобы расстояния везде считались одинаково.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371000 // Радиус Земли в метрах
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaPhi := (lat2 - lat1) * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*
+			math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return R * c
+}
+
+// Ring замкнутый контур полигона (первая точка совпадает с последней).
+type Ring []Position
+
+// Polygon полигон: первый контур внешний, остальные — отверстия.
+type Polygon []Ring
+
+// Geometry произвольная область инцидента: Polygon или MultiPolygon.
+// Внутри всегда хранится как набор полигонов, в JSON сериализуется в формате GeoJSON.
+type Geometry struct {
+	Type     string
+	Polygons []Polygon
+}
+
+type geometryJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// MarshalJSON сериализует геометрию в GeoJSON.
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	var coords interface{}
+	switch g.Type {
+	case GeometryPolygon:
+		if len(g.Polygons) != 1 {
+			return nil, fmt.Errorf("polygon geometry must contain exactly one polygon")
+		}
+		coords = g.Polygons[0]
+	case GeometryMultiPolygon:
+		coords = g.Polygons
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %q", g.Type)
+	}
+
+	raw, err := json.Marshal(coords)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geometryJSON{Type: g.Type, Coordinates: raw})
+}
+
+// UnmarshalJSON разбирает GeoJSON-геометрию типа Polygon или MultiPolygon.
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var raw geometryJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch raw.Type {
+	case GeometryPolygon:
+		var p Polygon
+		if err := json.Unmarshal(raw.Coordinates, &p); err != nil {
+			return fmt.Errorf("invalid polygon coordinates: %w", err)
+		}
+		g.Polygons = []Polygon{p}
+	case GeometryMultiPolygon:
+		var mp []Polygon
+		if err := json.Unmarshal(raw.Coordinates, &mp); err != nil {
+			return fmt.Errorf("invalid multipolygon coordinates: %w", err)
+		}
+		g.Polygons = mp
+	default:
+		return fmt.Errorf("unsupported geometry type: %q", raw.Type)
+	}
+	g.Type = raw.Type
+	return nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// Delivery Log Repository
+
+// deliveryColumns список колонок журнала доставок в порядке, ожидаемом scanDelivery.
+const deliveryColumns = `id, delivery_id, subscription_id, url, event, incident_id, user_id, attempt,
+	request_body, response_status, latency_ms, error, status, created_at`
+
+// scanDelivery считывает запись журнала доставок.
+func scanDelivery(row rowScanner) (*entity.WebhookDelivery, error) {
+	var d entity.WebhookDelivery
+	err := row.Scan(&d.ID, &d.DeliveryID, &d.SubscriptionID, &d.URL, &d.Event, &d.IncidentID, &d.UserID, &d.Attempt,
+		&d.RequestBody, &d.ResponseStatus, &d.LatencyMs, &d.Error, &d.Status, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// queryDeliveries выполняет запрос и считывает все записи журнала.
+func (r *PostgresRepo) queryDeliveries(ctx context.Context, sql string, args ...any) ([]*entity.WebhookDelivery, error) {
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*entity.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordDelivery сохраняет попытку доставки.
+func (r *PostgresRepo) RecordDelivery(ctx context.Context, d *entity.WebhookDelivery) error {
+	sql := `INSERT INTO webhook_deliveries (delivery_id, subscription_id, url, event, incident_id, user_id, attempt,
+				request_body, response_status, latency_ms, error, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW()) RETURNING id, created_at`
+	return r.Pool.QueryRow(ctx, sql, d.DeliveryID, d.SubscriptionID, d.URL, d.Event, d.IncidentID, d.UserID, d.Attempt,
+		[]byte(d.RequestBody), d.ResponseStatus, d.LatencyMs, d.Error, d.Status).Scan(&d.ID, &d.CreatedAt)
+}
+
+// GetDelivery получает запись журнала по ID.
+func (r *PostgresRepo) GetDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error) {
+	d, err := scanDelivery(r.Pool.QueryRow(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("not found")
+	}
+	return d, err
+}
+
+// GetDeliveries возвращает записи журнала по фильтру (новые первыми).
+func (r *PostgresRepo) GetDeliveries(ctx context.Context, f entity.DeliveryFilter) ([]*entity.WebhookDelivery, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.SubscriptionID != nil {
+		add("subscription_id = $%d", *f.SubscriptionID)
+	}
+	if f.IncidentID != nil {
+		add("incident_id = $%d", *f.IncidentID)
+	}
+	if f.UserID != "" {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.After != nil {
+		args = append(args, f.After.Time, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	sql := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries`
+	if len(conds) > 0 {
+		sql += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	sql += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	return r.queryDeliveries(ctx, sql, args...)
+}
+
+// GetFailedDeliveries возвращает последнюю попытку каждой доставки, неудачно завершившейся в интервале [from, to)
+// и так и не доставленной (без успешной попытки позже). Используется для повторной отправки за период.
+func (r *PostgresRepo) GetFailedDeliveries(ctx context.Context, from, to time.Time, subscriptionID *int, limit int) ([]*entity.WebhookDelivery, error) {
+	sql := `SELECT ` + deliveryColumns + ` FROM (
+				SELECT DISTINCT ON (delivery_id) * FROM webhook_deliveries
+				WHERE created_at >= $1 AND created_at < $2 AND ($3::int IS NULL OR subscription_id = $3)
+				ORDER BY delivery_id, created_at DESC, id DESC
+			) last
+			WHERE status = 'failed'
+			  AND NOT EXISTS (
+				SELECT 1 FROM webhook_deliveries ok
+				WHERE ok.delivery_id = last.delivery_id AND ok.status = 'succeeded'
+			  )
+			ORDER BY created_at
+			LIMIT $4`
+	return r.queryDeliveries(ctx, sql, from, to, subscriptionID, limit)
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// Outbox Repository
+
+// SaveOutbox сохраняет сообщения outbox одной транзакцией; их опубликует ретранслятор.
+func (r *PostgresRepo) SaveOutbox(ctx context.Context, messages []*entity.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, m := range messages {
+		batch.Queue(`INSERT INTO outbox (queue, payload) VALUES ($1, $2)`, m.Queue, []byte(m.Payload))
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// insertOutbox сохраняет в транзакции изменения сообщения outbox, которые events формирует по инциденту i
+// (nil — сообщений нет).
+func insertOutbox(ctx context.Context, q querier, events entity.OutboxFunc, i *entity.Incident) error {
+	if events == nil {
+		return nil
+	}
+	messages, err := events(i)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if _, err := q.Exec(ctx, `INSERT INTO outbox (queue, payload) VALUES ($1, $2)`, m.Queue, []byte(m.Payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishOutbox блокирует пачку неотправленных сообщений (FOR UPDATE SKIP LOCKED — несколько ретрансляторов
+// не получат одни и те же строки), публикует их по порядку и помечает отправленными.
+// Публикация останавливается на первой ошибке; неопубликованные сообщения останутся для следующей попытки.
+func (r *PostgresRepo) PublishOutbox(ctx context.Context, limit int, publish func(*entity.OutboxMessage) error) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id, queue, payload, created_at FROM outbox
+		WHERE sent_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var messages []*entity.OutboxMessage
+	for rows.Next() {
+		var m entity.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Queue, &m.Payload, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, &m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var sent []int64
+	var publishErr error
+	for _, m := range messages {
+		if publishErr = publish(m); publishErr != nil {
+			break
+		}
+		sent = append(sent, m.ID)
+	}
+
+	if len(sent) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = NOW() WHERE id = ANY($1)`, sent); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(sent), publishErr
+}
+
+// PurgeOutbox удаляет отправленные сообщения старше before.
+func (r *PostgresRepo) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ct, err := r.Pool.Exec(ctx, `DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return ct.RowsAffected(), nil
+}
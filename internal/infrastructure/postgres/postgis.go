@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// PostGISRepo репозиторий инцидентов поверх PostGIS.
+// Запись и чтение полностью совпадают с PostgresRepo: колонку geog поддерживает триггер из migrations/postgis,
+// а сопоставление точки с зонами выполняется в БД по GiST-индексу.
+type PostGISRepo struct {
+	*PostgresRepo
+}
+
+// NewPostGIS создает репозиторий PostGIS поверх существующего подключения и проверяет наличие расширения.
+func NewPostGIS(ctx context.Context, r *PostgresRepo) (*PostGISRepo, error) {
+	var version string
+	if err := r.Pool.QueryRow(ctx, `SELECT PostGIS_Version()`).Scan(&version); err != nil {
+		return nil, fmt.Errorf("postgis is not available: %w", err)
+	}
+	return &PostGISRepo{PostgresRepo: r}, nil
+}
+
+// FindContaining возвращает активные инциденты, зона которых содержит точку.
+// Отбор кандидатов идет по индексу (&&), точная проверка круговых зон — по сфере, как и в distanceMeters.
+func (r *PostGISRepo) FindContaining(ctx context.Context, lat, lon float64) ([]*entity.Incident, error) {
+	sql := `
+    WITH pt AS (SELECT ST_SetSRID(ST_MakePoint($2, $1), 4326)::geography AS g)
+    SELECT ` + incidentColumns + `
+    FROM incidents, pt
+    WHERE ` + activeIncidentCondition + `
+      AND geog && pt.g
+      AND CASE
+            WHEN geometry IS NULL THEN ST_DWithin(ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography, pt.g, radius_meters, false)
+            ELSE ST_Covers(geog, pt.g)
+          END
+    `
+	rows, err := r.Pool.Query(ctx, sql, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return scanIncidents(rows)
+}
@@ -2,10 +2,14 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/paincake00/geocore/internal/entity"
 )
@@ -49,94 +53,338 @@ func (r *PostgresRepo) Ping(ctx context.Context) error {
 
 // Incident Repository
 
-// Create сохраняет новый инцидент в БД.
-func (r *PostgresRepo) Create(ctx context.Context, i *entity.Incident) error {
-	sql := `INSERT INTO incidents (title, description, latitude, longitude, radius_meters, created_at)
-			VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id, created_at`
-	return r.Pool.QueryRow(ctx, sql, i.Title, i.Description, i.Latitude, i.Longitude, i.RadiusMeters).Scan(&i.ID, &i.CreatedAt)
+// incidentColumns список колонок инцидента в порядке, ожидаемом scanIncident.
+const incidentColumns = `id, title, description, latitude, longitude, radius_meters, geometry, status, severity, category, starts_at, expires_at, created_at, deleted_at`
+
+// activeIncidentCondition условие отбора действующих инцидентов: не удален, статус active и текущий момент внутри окна действия.
+const activeIncidentCondition = `deleted_at IS NULL AND status = 'active' AND (starts_at IS NULL OR starts_at <= NOW()) AND (expires_at IS NULL OR expires_at > NOW())`
+
+// rowScanner общий интерфейс для pgx.Row и pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// GetByID получает инцидент по ID.
-func (r *PostgresRepo) GetByID(ctx context.Context, id int) (*entity.Incident, error) {
-	sql := `SELECT id, title, description, latitude, longitude, radius_meters, created_at FROM incidents WHERE id = $1`
+// querier общий интерфейс для пула соединений и транзакции.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// scanIncident считывает инцидент из строки результата, включая геометрию в формате GeoJSON.
+func scanIncident(row rowScanner) (*entity.Incident, error) {
 	var i entity.Incident
-	err := r.Pool.QueryRow(ctx, sql, id).Scan(&i.ID, &i.Title, &i.Description, &i.Latitude, &i.Longitude, &i.RadiusMeters, &i.CreatedAt)
-	if err != nil {
+	var geometry []byte
+	if err := row.Scan(&i.ID, &i.Title, &i.Description, &i.Latitude, &i.Longitude, &i.RadiusMeters, &geometry,
+		&i.Status, &i.Severity, &i.Category, &i.StartsAt, &i.ExpiresAt, &i.CreatedAt, &i.DeletedAt); err != nil {
 		return nil, err
 	}
+	if geometry != nil {
+		i.Geometry = &entity.Geometry{}
+		if err := json.Unmarshal(geometry, i.Geometry); err != nil {
+			return nil, fmt.Errorf("invalid geometry of incident %d: %w", i.ID, err)
+		}
+	}
 	return &i, nil
 }
 
-// GetAll получает список инцидентов с пагинацией.
-func (r *PostgresRepo) GetAll(ctx context.Context, limit, offset int) ([]*entity.Incident, error) {
-	sql := `SELECT id, title, description, latitude, longitude, radius_meters, created_at FROM incidents ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-	rows, err := r.Pool.Query(ctx, sql, limit, offset)
-	if err != nil {
-		return nil, err
-	}
+// scanIncidents считывает все инциденты из результата запроса.
+func scanIncidents(rows pgx.Rows) ([]*entity.Incident, error) {
 	defer rows.Close()
 
 	var incidents []*entity.Incident
 	for rows.Next() {
-		var i entity.Incident
-		if err := rows.Scan(&i.ID, &i.Title, &i.Description, &i.Latitude, &i.Longitude, &i.RadiusMeters, &i.CreatedAt); err != nil {
+		i, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, i)
+	}
+	return incidents, rows.Err()
+}
+
+// incidentArgs возвращает значения изменяемых колонок инцидента в порядке
+// title, description, latitude, longitude, radius_meters, geometry, status, starts_at, expires_at, severity, category.
+func incidentArgs(i *entity.Incident) ([]any, error) {
+	var geometry any // NULL для круговых зон
+	if i.Geometry != nil {
+		data, err := json.Marshal(i.Geometry)
+		if err != nil {
 			return nil, err
 		}
-		incidents = append(incidents, &i)
+		geometry = data
+	}
+	return []any{i.Title, i.Description, i.Latitude, i.Longitude, i.RadiusMeters, geometry, i.Status, i.StartsAt, i.ExpiresAt, i.Severity, i.Category}, nil
+}
+
+// insertIncident вставляет инцидент, заполняет его ID и время создания и записывает первую ревизию истории.
+func insertIncident(ctx context.Context, q querier, i *entity.Incident) error {
+	args, err := incidentArgs(i)
+	if err != nil {
+		return err
+	}
+	sql := `INSERT INTO incidents (title, description, latitude, longitude, radius_meters, geometry, status, starts_at, expires_at, severity, category, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW()) RETURNING id, created_at`
+	if err := q.QueryRow(ctx, sql, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return err
+	}
+	return insertRevision(ctx, q, i, entity.RevisionActionCreated)
+}
+
+// Create сохраняет новый инцидент в БД вместе с первой ревизией истории и сообщениями outbox.
+func (r *PostgresRepo) Create(ctx context.Context, i *entity.Incident, events entity.OutboxFunc) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	if err := insertIncident(ctx, tx, i); err != nil {
+		return err
+	}
+	if err := insertOutbox(ctx, tx, events, i); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateBatch сохраняет несколько инцидентов и их сообщения outbox в одной транзакции.
+func (r *PostgresRepo) CreateBatch(ctx context.Context, incidents []*entity.Incident, events entity.OutboxFunc) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	for n, i := range incidents {
+		if err := insertIncident(ctx, tx, i); err != nil {
+			return fmt.Errorf("incident %d: %w", n, err)
+		}
+		if err := insertOutbox(ctx, tx, events, i); err != nil {
+			return fmt.Errorf("incident %d: %w", n, err)
+		}
 	}
-	return incidents, nil
+	return tx.Commit(ctx)
 }
 
-// GetAllActive возвращает все инциденты.
-// В реальной системе стоит фильтровать по статусу "active" или времени истечения.
-// В рамках задачи считаем все записи в таблице активными.
+// GetByID получает инцидент по ID (удаленные не возвращаются).
+func (r *PostgresRepo) GetByID(ctx context.Context, id int) (*entity.Incident, error) {
+	sql := `SELECT ` + incidentColumns + ` FROM incidents WHERE id = $1 AND deleted_at IS NULL`
+	return scanIncident(r.Pool.QueryRow(ctx, sql, id))
+}
+
+// incidentSortColumns допустимые поля сортировки списка инцидентов.
+var incidentSortColumns = map[string]string{
+	entity.IncidentSortCreatedAt: "created_at",
+	entity.IncidentSortTitle:     "title",
+	entity.IncidentSortStatus:    "status",
+	entity.IncidentSortExpiresAt: "expires_at",
+}
+
+// likeEscaper экранирует спецсимволы шаблона LIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetAll получает список инцидентов с фильтрами, сортировкой и пагинацией (по курсору или смещению).
+// Отбор по области идет по охватывающему прямоугольнику зоны (колонки min_lat/min_lon/max_lat/max_lon).
+// Удаленные инциденты не возвращаются.
+func (r *PostgresRepo) GetAll(ctx context.Context, f entity.IncidentFilter) ([]*entity.Incident, error) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if b := f.BBox; b != nil {
+		add("max_lat >= $%d", b.MinLat)
+		add("min_lat <= $%d", b.MaxLat)
+		if b.MinLon <= b.MaxLon {
+			add("max_lon >= $%d", b.MinLon)
+			add("min_lon <= $%d", b.MaxLon)
+		} else {
+			// Область пересекает антимеридиан: [MinLon, 180] и [-180, MaxLon]
+			args = append(args, b.MinLon, b.MaxLon)
+			conds = append(conds, fmt.Sprintf("(max_lon >= $%d OR min_lon <= $%d)", len(args)-1, len(args)))
+		}
+	}
+	if f.CreatedFrom != nil {
+		add("created_at >= $%d", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		add("created_at < $%d", *f.CreatedTo)
+	}
+	if len(f.Statuses) > 0 {
+		add("status = ANY($%d)", f.Statuses)
+	}
+	if len(f.Severities) > 0 {
+		add("severity = ANY($%d)", f.Severities)
+	}
+	if len(f.Categories) > 0 {
+		add("category = ANY($%d)", f.Categories)
+	}
+	if f.Query != "" {
+		add("(title ILIKE $%[1]d OR description ILIKE $%[1]d)", "%"+likeEscaper.Replace(f.Query)+"%")
+	}
+
+	column, desc := strings.CutPrefix(f.Sort, "-")
+	if f.Sort == "" {
+		column, desc = entity.IncidentSortCreatedAt, true
+	}
+	order, ok := incidentSortColumns[column]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort: %q", f.Sort)
+	}
+	if f.After != nil {
+		if !f.KeysetSort() {
+			return nil, fmt.Errorf("cursor is not supported for sort %q", f.Sort)
+		}
+		// Keyset-пагинация: строки строго после курсора в порядке (created_at, id)
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		args = append(args, f.After.Time, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, id) %s ($%d, $%d)", op, len(args)-1, len(args)))
+	}
+	if desc {
+		order += " DESC NULLS LAST, id DESC"
+	} else {
+		order += " ASC NULLS LAST, id ASC"
+	}
+
+	sql := `SELECT ` + incidentColumns + ` FROM incidents WHERE ` + strings.Join(conds, " AND ")
+	args = append(args, f.Limit, f.Offset)
+	sql += fmt.Sprintf(` ORDER BY %s LIMIT $%d OFFSET $%d`, order, len(args)-1, len(args))
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIncidents(rows)
+}
+
+// GetAllActive возвращает действующие инциденты: в статусе active, уже начавшиеся и еще не истекшие.
 func (r *PostgresRepo) GetAllActive(ctx context.Context) ([]*entity.Incident, error) {
-	sql := `SELECT id, title, description, latitude, longitude, radius_meters, created_at FROM incidents`
+	sql := `SELECT ` + incidentColumns + ` FROM incidents WHERE ` + activeIncidentCondition
 	rows, err := r.Pool.Query(ctx, sql)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanIncidents(rows)
+}
 
-	var incidents []*entity.Incident
-	for rows.Next() {
-		var i entity.Incident
-		if err := rows.Scan(&i.ID, &i.Title, &i.Description, &i.Latitude, &i.Longitude, &i.RadiusMeters, &i.CreatedAt); err != nil {
-			return nil, err
-		}
-		incidents = append(incidents, &i)
+// GetActiveOrScheduled возвращает действующие инциденты и инциденты в статусе active, которые начнутся не позже until.
+func (r *PostgresRepo) GetActiveOrScheduled(ctx context.Context, until time.Time) ([]*entity.Incident, error) {
+	sql := `SELECT ` + incidentColumns + ` FROM incidents
+			WHERE deleted_at IS NULL AND status = 'active' AND (starts_at IS NULL OR starts_at <= $1) AND (expires_at IS NULL OR expires_at > NOW())`
+	rows, err := r.Pool.Query(ctx, sql, until)
+	if err != nil {
+		return nil, err
 	}
-	return incidents, nil
+	return scanIncidents(rows)
 }
 
-// Update обновляет данные инцидента.
-func (r *PostgresRepo) Update(ctx context.Context, i *entity.Incident) error {
-	sql := `UPDATE incidents SET title=$1, description=$2, latitude=$3, longitude=$4, radius_meters=$5 WHERE id=$6`
-	ct, err := r.Pool.Exec(ctx, sql, i.Title, i.Description, i.Latitude, i.Longitude, i.RadiusMeters, i.ID)
+// updateIncident перезаписывает изменяемые колонки инцидента (в том числе удаленного при restore)
+// и возвращает его новое состояние.
+func updateIncident(ctx context.Context, q querier, i *entity.Incident, restore bool) (*entity.Incident, error) {
+	args, err := incidentArgs(i)
+	if err != nil {
+		return nil, err
+	}
+	sql := `UPDATE incidents SET title=$1, description=$2, latitude=$3, longitude=$4, radius_meters=$5, geometry=$6,
+			status=$7, starts_at=$8, expires_at=$9, severity=$10, category=$11, deleted_at=NULL
+			WHERE id=$12 AND ($13 OR deleted_at IS NULL) RETURNING ` + incidentColumns
+	updated, err := scanIncident(q.QueryRow(ctx, sql, append(args, i.ID, restore)...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("not found")
+	}
+	return updated, err
+}
+
+// Update обновляет данные инцидента и записывает ревизию истории и сообщения outbox в той же транзакции.
+func (r *PostgresRepo) Update(ctx context.Context, i *entity.Incident, events entity.OutboxFunc) error {
+	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	if ct.RowsAffected() == 0 {
-		return errors.New("not found")
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	updated, err := updateIncident(ctx, tx, i, false)
+	if err != nil {
+		return err
+	}
+	if err := insertRevision(ctx, tx, updated, entity.RevisionActionUpdated); err != nil {
+		return err
+	}
+	if err := insertOutbox(ctx, tx, events, updated); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
 	}
+	i.CreatedAt = updated.CreatedAt
 	return nil
 }
 
-// Delete удаляет инцидент.
-func (r *PostgresRepo) Delete(ctx context.Context, id int) error {
-	sql := `DELETE FROM incidents WHERE id=$1`
-	ct, err := r.Pool.Exec(ctx, sql, id)
+// ExpireIncidents переводит истекшие активные инциденты в статус resolved и возвращает их.
+// Обновление атомарно, поэтому при нескольких экземплярах сервиса каждый инцидент будет возвращен ровно один раз;
+// сообщения outbox по каждому инциденту сохраняются в той же транзакции.
+func (r *PostgresRepo) ExpireIncidents(ctx context.Context, events entity.OutboxFunc) ([]*entity.Incident, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	sql := `UPDATE incidents SET status = 'resolved'
+			WHERE deleted_at IS NULL AND status = 'active' AND expires_at IS NOT NULL AND expires_at <= NOW()
+			RETURNING ` + incidentColumns
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := scanIncidents(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range resolved {
+		if err := insertRevision(ctx, tx, i, entity.RevisionActionExpired); err != nil {
+			return nil, err
+		}
+		if err := insertOutbox(ctx, tx, events, i); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, tx.Commit(ctx)
+}
+
+// Delete помечает инцидент удаленным. Строка остается в БД, поэтому сохраняются история и статистика проверок.
+// Сообщения outbox формируются по последнему состоянию инцидента (с заполненным deleted_at).
+func (r *PostgresRepo) Delete(ctx context.Context, id int, events entity.OutboxFunc) error {
+	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	if ct.RowsAffected() == 0 {
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	sql := `UPDATE incidents SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING ` + incidentColumns
+	deleted, err := scanIncident(tx.QueryRow(ctx, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
 		return errors.New("not found")
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+	if err := insertRevision(ctx, tx, deleted, entity.RevisionActionDeleted); err != nil {
+		return err
+	}
+	if err := insertOutbox(ctx, tx, events, deleted); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // GetStats возвращает статистику: уникальные пользователи на инцидент за период.
-func (r *PostgresRepo) GetStats(ctx context.Context, windowMinutes int) (map[int]int, error) {
+// Фильтры по уровню опасности и категории применяются к инцидентам.
+func (r *PostgresRepo) GetStats(ctx context.Context, windowMinutes int, f entity.StatsFilter) (map[int]int, error) {
 	// Возвращаем количество уникальных пользователей на каждый инцидент за последние N минут
 	startTime := time.Now().Add(-time.Duration(windowMinutes) * time.Minute)
 
@@ -144,11 +392,14 @@ func (r *PostgresRepo) GetStats(ctx context.Context, windowMinutes int) (map[int
     SELECT lci.incident_id, COUNT(DISTINCT lc.user_id)
     FROM location_check_incidents lci
     JOIN location_checks lc ON lci.location_check_id = lc.id
+    JOIN incidents i ON lci.incident_id = i.id
     WHERE lc.checked_at >= $1
+      AND (COALESCE(cardinality($2::text[]), 0) = 0 OR i.severity = ANY($2))
+      AND (COALESCE(cardinality($3::text[]), 0) = 0 OR i.category = ANY($3))
     GROUP BY lci.incident_id
     `
 
-	rows, err := r.Pool.Query(ctx, sql, startTime)
+	rows, err := r.Pool.Query(ctx, sql, startTime, f.Severities, f.Categories)
 	if err != nil {
 		return nil, err
 	}
@@ -167,21 +418,182 @@ func (r *PostgresRepo) GetStats(ctx context.Context, windowMinutes int) (map[int
 
 // LocationCheck Repository
 
-// CreateCheck создает запись о проверке местоположения.
-func (r *PostgresRepo) CreateCheck(ctx context.Context, check *entity.LocationCheck) error {
+// SaveLocationCheck сохраняет проверку местоположения, совпавшие зоны и сообщения outbox в одной транзакции:
+// событие не может потеряться, если проверка записана, и наоборот.
+func (r *PostgresRepo) SaveLocationCheck(ctx context.Context, check *entity.LocationCheck, incidentIDs []int, outbox []*entity.OutboxMessage) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	sql := `INSERT INTO location_checks (user_id, latitude, longitude, checked_at)
             VALUES ($1, $2, $3, NOW()) RETURNING id, checked_at`
-	return r.Pool.QueryRow(ctx, sql, check.UserID, check.Latitude, check.Longitude).Scan(&check.ID, &check.CheckedAt)
+	if err := tx.QueryRow(ctx, sql, check.UserID, check.Latitude, check.Longitude).Scan(&check.ID, &check.CheckedAt); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for _, id := range incidentIDs {
+		// Фиксируем факт попадания проверки в инцидент
+		batch.Queue(`INSERT INTO location_check_incidents (location_check_id, incident_id) VALUES ($1, $2)`, check.ID, id)
+	}
+	for _, m := range outbox {
+		batch.Queue(`INSERT INTO outbox (queue, payload) VALUES ($1, $2)`, m.Queue, []byte(m.Payload))
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetLocationChecks возвращает журнал проверок местоположения (новые первыми) с зонами, в которые попала каждая точка.
+func (r *PostgresRepo) GetLocationChecks(ctx context.Context, f entity.CheckFilter) ([]*entity.LocationCheck, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != "" {
+		add("c.user_id = $%d", f.UserID)
+	}
+	if f.IncidentID != nil {
+		add("EXISTS (SELECT 1 FROM location_check_incidents m WHERE m.location_check_id = c.id AND m.incident_id = $%d)", *f.IncidentID)
+	}
+	if f.From != nil {
+		add("c.checked_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("c.checked_at < $%d", *f.To)
+	}
+	if f.After != nil {
+		args = append(args, f.After.Time, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(c.checked_at, c.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	sql := `SELECT c.id, c.user_id, c.latitude, c.longitude, c.checked_at, c.recorded_at,
+				COALESCE((SELECT array_agg(m.incident_id ORDER BY m.incident_id) FROM location_check_incidents m WHERE m.location_check_id = c.id), '{}')
+			FROM location_checks c`
+	if len(conds) > 0 {
+		sql += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit)
+	sql += fmt.Sprintf(` ORDER BY c.checked_at DESC, c.id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []*entity.LocationCheck
+	for rows.Next() {
+		var c entity.LocationCheck
+		var incidentIDs []int32
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Latitude, &c.Longitude, &c.CheckedAt, &c.RecordedAt, &incidentIDs); err != nil {
+			return nil, err
+		}
+		for _, id := range incidentIDs {
+			c.IncidentIDs = append(c.IncidentIDs, int(id))
+		}
+		checks = append(checks, &c)
+	}
+	return checks, rows.Err()
 }
 
-// RecordIncidentMatch фиксирует факт попадания проверки в инцидент.
-func (r *PostgresRepo) RecordIncidentMatch(ctx context.Context, checkID, incidentID int) error {
-	sql := `INSERT INTO location_check_incidents (location_check_id, incident_id) VALUES ($1, $2)`
-	_, err := r.Pool.Exec(ctx, sql, checkID, incidentID)
-	return err
+// FindLastLocations возвращает последние проверки пользователей не старше since, попавшие в прямоугольник area.
+func (r *PostgresRepo) FindLastLocations(ctx context.Context, area entity.BBox, since time.Time) ([]*entity.LocationCheck, error) {
+	lonCond := `longitude BETWEEN $4 AND $5`
+	if area.MinLon > area.MaxLon {
+		// Область пересекает антимеридиан: [MinLon, 180] и [-180, MaxLon]
+		lonCond = `(longitude >= $4 OR longitude <= $5)`
+	}
+	sql := `SELECT id, user_id, latitude, longitude, checked_at
+			FROM (
+				SELECT DISTINCT ON (user_id) id, user_id, latitude, longitude, checked_at
+				FROM location_checks
+				WHERE checked_at >= $1
+				ORDER BY user_id, LEAST(COALESCE(recorded_at, checked_at), checked_at) DESC, id DESC -- как LocationCheck.PointTime
+			) last
+			WHERE latitude BETWEEN $2 AND $3 AND ` + lonCond
+	rows, err := r.Pool.Query(ctx, sql, since, area.MinLat, area.MaxLat, area.MinLon, area.MaxLon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []*entity.LocationCheck
+	for rows.Next() {
+		var c entity.LocationCheck
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Latitude, &c.Longitude, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, &c)
+	}
+	return checks, rows.Err()
 }
 
-// CreateLocationCheck адаптер для интерфейса.
-func (r *PostgresRepo) CreateLocationCheck(ctx context.Context, check *entity.LocationCheck) error {
-	return r.CreateCheck(ctx, check)
+// SaveLocationChecks сохраняет пакет проверок через COPY в одной транзакции с совпадениями и сообщениями outbox.
+// Идентификаторы проверок выделяются из последовательности заранее, чтобы связать с ними совпадения без RETURNING.
+// checked_at заполняется значением по умолчанию NOW(), как и в SaveLocationCheck, поэтому оба пути пишут время
+// по одним часам (БД) в одном часовом поясе; в проверки записывается то же время начала транзакции.
+func (r *PostgresRepo) SaveLocationChecks(ctx context.Context, checks []*entity.LocationCheck, matches [][]int, outbox []*entity.OutboxMessage) error {
+	if len(checks) == 0 {
+		return nil
+	}
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT nextval(pg_get_serial_sequence('location_checks', 'id')) FROM generate_series(1, $1)`, len(checks))
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+	var checkedAt time.Time
+	if err := tx.QueryRow(ctx, `SELECT NOW()`).Scan(&checkedAt); err != nil {
+		return err
+	}
+
+	checkRows := make([][]any, len(checks))
+	var matchRows [][]any
+	for n, check := range checks {
+		check.ID = ids[n]
+		check.CheckedAt = checkedAt
+		checkRows[n] = []any{check.ID, check.UserID, check.Latitude, check.Longitude, check.RecordedAt}
+		for _, incidentID := range matches[n] {
+			matchRows = append(matchRows, []any{check.ID, incidentID})
+		}
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"location_checks"},
+		[]string{"id", "user_id", "latitude", "longitude", "recorded_at"}, pgx.CopyFromRows(checkRows)); err != nil {
+		return err
+	}
+	if len(matchRows) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"location_check_incidents"},
+			[]string{"location_check_id", "incident_id"}, pgx.CopyFromRows(matchRows)); err != nil {
+			return err
+		}
+	}
+	if len(outbox) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"outbox"}, []string{"queue", "payload"},
+			pgx.CopyFromSlice(len(outbox), func(i int) ([]any, error) {
+				return []any{outbox[i].Queue, outbox[i].Payload}, nil
+			})); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// Incident Revisions
+
+// revisionColumns список колонок ревизии в порядке, ожидаемом scanRevision.
+const revisionColumns = `id, incident_id, revision, action, actor, COALESCE(operator, ''), snapshot, created_at`
+
+// insertRevision записывает очередную ревизию инцидента: его состояние после изменения, автора и оператора из контекста.
+// Вызывается в транзакции изменения, строка инцидента к этому моменту заблокирована, поэтому номера ревизий не пересекаются.
+func insertRevision(ctx context.Context, q querier, i *entity.Incident, action string) error {
+	snapshot, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	sql := `INSERT INTO incident_revisions (incident_id, revision, action, actor, operator, snapshot, created_at)
+			SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, NULLIF($4, ''), $5, NOW() FROM incident_revisions WHERE incident_id = $1`
+	_, err = q.Exec(ctx, sql, i.ID, action, entity.ActorFromContext(ctx), entity.OperatorFromContext(ctx), snapshot)
+	return err
+}
+
+// scanRevision считывает ревизию инцидента из строки результата.
+func scanRevision(row rowScanner) (*entity.IncidentRevision, error) {
+	var rev entity.IncidentRevision
+	var snapshot []byte
+	if err := row.Scan(&rev.ID, &rev.IncidentID, &rev.Revision, &rev.Action, &rev.Actor, &rev.Operator, &snapshot, &rev.CreatedAt); err != nil {
+		return nil, err
+	}
+	rev.Incident = &entity.Incident{}
+	if err := json.Unmarshal(snapshot, rev.Incident); err != nil {
+		return nil, fmt.Errorf("invalid snapshot of incident %d revision %d: %w", rev.IncidentID, rev.Revision, err)
+	}
+	return &rev, nil
+}
+
+// GetRevisions возвращает историю изменений инцидента (в том числе удаленного) в порядке ревизий.
+func (r *PostgresRepo) GetRevisions(ctx context.Context, incidentID int) ([]*entity.IncidentRevision, error) {
+	sql := `SELECT ` + revisionColumns + `
+			FROM incident_revisions WHERE incident_id = $1 ORDER BY revision`
+	rows, err := r.Pool.Query(ctx, sql, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*entity.IncidentRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// RestoreRevision возвращает инцидент к состоянию из ревизии (удаленный инцидент при этом восстанавливается)
+// и записывает это как новую ревизию вместе с сообщениями outbox.
+func (r *PostgresRepo) RestoreRevision(ctx context.Context, incidentID, revision int, events entity.OutboxFunc) (*entity.Incident, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	sql := `SELECT ` + revisionColumns + `
+			FROM incident_revisions WHERE incident_id = $1 AND revision = $2`
+	rev, err := scanRevision(tx.QueryRow(ctx, sql, incidentID, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Incident.ID = incidentID
+	restored, err := updateIncident(ctx, tx, rev.Incident, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertRevision(ctx, tx, restored, entity.RevisionActionRestored); err != nil {
+		return nil, err
+	}
+	if err := insertOutbox(ctx, tx, events, restored); err != nil {
+		return nil, err
+	}
+	return restored, tx.Commit(ctx)
+}
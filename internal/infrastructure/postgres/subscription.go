@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// Subscription Repository
+
+// subscriptionColumns список колонок подписки в порядке, ожидаемом scanSubscription.
+const subscriptionColumns = `id, url, event_types, incident_ids, categories, min_severity, secret, previous_secrets, previous_secrets_expire_at, max_attempts, max_age_seconds, active, created_at`
+
+// scanSubscription считывает подписку из строки результата.
+func scanSubscription(row rowScanner) (*entity.WebhookSubscription, error) {
+	var s entity.WebhookSubscription
+	var previous []string
+	var expireAt []time.Time
+	if err := row.Scan(&s.ID, &s.URL, &s.EventTypes, &s.IncidentIDs, &s.Categories, &s.MinSeverity, &s.Secret, &previous, &expireAt, &s.MaxAttempts, &s.MaxAgeSeconds, &s.Active, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	s.PreviousSecrets = previousSecrets(previous, expireAt)
+	return &s, nil
+}
+
+// previousSecrets собирает предыдущие секреты из параллельных массивов previous_secrets и previous_secrets_expire_at.
+func previousSecrets(secrets []string, expireAt []time.Time) []entity.PreviousSecret {
+	var res []entity.PreviousSecret
+	for n, secret := range secrets {
+		p := entity.PreviousSecret{Secret: secret}
+		if n < len(expireAt) {
+			p.ExpiresAt = expireAt[n]
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// querySubscriptions выполняет запрос и считывает все подписки.
+func (r *PostgresRepo) querySubscriptions(ctx context.Context, sql string, args ...any) ([]*entity.WebhookSubscription, error) {
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*entity.WebhookSubscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// CreateSubscription сохраняет новую подписку.
+func (r *PostgresRepo) CreateSubscription(ctx context.Context, s *entity.WebhookSubscription) error {
+	sql := `INSERT INTO webhook_subscriptions (url, event_types, incident_ids, categories, min_severity, secret, max_attempts, max_age_seconds, active, created_at)
+			VALUES ($1, COALESCE($2, '{}'::text[]), COALESCE($3, '{}'::int[]), COALESCE($4, '{}'::text[]), $5, $6, $7, $8, $9, NOW())
+			RETURNING id, created_at`
+	return r.Pool.QueryRow(ctx, sql, s.URL, s.EventTypes, s.IncidentIDs, s.Categories, s.MinSeverity, s.Secret, s.MaxAttempts, s.MaxAgeSeconds, s.Active).
+		Scan(&s.ID, &s.CreatedAt)
+}
+
+// GetSubscription получает подписку по ID.
+func (r *PostgresRepo) GetSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error) {
+	sql := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	return scanSubscription(r.Pool.QueryRow(ctx, sql, id))
+}
+
+// GetSubscriptions возвращает все подписки.
+func (r *PostgresRepo) GetSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	return r.querySubscriptions(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+}
+
+// GetActiveSubscriptions возвращает включенные подписки (для рассылки событий).
+func (r *PostgresRepo) GetActiveSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	return r.querySubscriptions(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE active ORDER BY id`)
+}
+
+// UpdateSubscription обновляет подписку. Секреты не меняются: для этого есть RotateSubscriptionSecret.
+func (r *PostgresRepo) UpdateSubscription(ctx context.Context, s *entity.WebhookSubscription) error {
+	sql := `UPDATE webhook_subscriptions SET url=$1, event_types=COALESCE($2, '{}'::text[]), incident_ids=COALESCE($3, '{}'::int[]),
+			categories=COALESCE($4, '{}'::text[]), min_severity=$5, max_attempts=$6, max_age_seconds=$7, active=$8
+			WHERE id=$9 RETURNING secret, previous_secrets, previous_secrets_expire_at, created_at`
+	var previous []string
+	var expireAt []time.Time
+	err := r.Pool.QueryRow(ctx, sql, s.URL, s.EventTypes, s.IncidentIDs, s.Categories, s.MinSeverity, s.MaxAttempts, s.MaxAgeSeconds, s.Active, s.ID).
+		Scan(&s.Secret, &previous, &expireAt, &s.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("not found")
+	}
+	s.PreviousSecrets = previousSecrets(previous, expireAt)
+	return err
+}
+
+// RotateSubscriptionSecret заменяет секрет подписки. Текущий секрет переносится в предыдущие со сроком действия grace
+// (истекшие и лишние сверх entity.MaxPreviousSecrets отбрасываются), либо все предыдущие отзываются (revokePrevious).
+func (r *PostgresRepo) RotateSubscriptionSecret(ctx context.Context, id int, secret string, grace time.Duration, revokePrevious bool) (*entity.WebhookSubscription, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // игнорируется после Commit
+
+	// Блокируем подписку: одновременные ротации не должны потерять секреты друг друга
+	sql := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1 FOR UPDATE`
+	s, err := scanSubscription(tx.QueryRow(ctx, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.RotateSecret(secret, time.Now(), grace, revokePrevious)
+	previous := make([]string, 0, len(s.PreviousSecrets))
+	expireAt := make([]time.Time, 0, len(s.PreviousSecrets))
+	for _, p := range s.PreviousSecrets {
+		previous, expireAt = append(previous, p.Secret), append(expireAt, p.ExpiresAt)
+	}
+	sql = `UPDATE webhook_subscriptions SET secret = $2, previous_secrets = $3, previous_secrets_expire_at = $4 WHERE id = $1`
+	if _, err := tx.Exec(ctx, sql, id, s.Secret, previous, expireAt); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit(ctx)
+}
+
+// DeleteSubscription удаляет подписку.
+func (r *PostgresRepo) DeleteSubscription(ctx context.Context, id int) error {
+	ct, err := r.Pool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return errors.New("not found")
+	}
+	return nil
+}
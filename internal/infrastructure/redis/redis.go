@@ -3,7 +3,13 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/paincake00/geocore/internal/entity"
@@ -13,6 +19,14 @@ import (
 // RedisRepo реализация репозитория на основе Redis (для очереди и кеша).
 type RedisRepo struct {
 	Client *redis.Client
+	// Consumer имя этого экземпляра в группе потребителей очередей.
+	Consumer string
+	// GeofenceTTL сколько хранится состояние пользователя в зонах после последней проверки.
+	GeofenceTTL time.Duration
+	// LastLocationTTL сколько последнее местоположение пользователя считается актуальным.
+	LastLocationTTL time.Duration
+
+	groups sync.Map // очереди, для которых уже создана группа потребителей
 }
 
 // New создает новое подключение к Redis.
@@ -25,7 +39,13 @@ func New(addr string) (*RedisRepo, error) {
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	return &RedisRepo{Client: client}, nil
+	hostname, _ := os.Hostname()
+	return &RedisRepo{
+		Client:          client,
+		Consumer:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		GeofenceTTL:     24 * time.Hour,
+		LastLocationTTL: time.Hour,
+	}, nil
 }
 
 // Close закрывает соединение.
@@ -39,42 +59,303 @@ func (r *RedisRepo) Ping(ctx context.Context) error {
 }
 
 // Queue (Очередь)
+//
+// Каждая очередь — поток Redis Streams с группой потребителей: сообщение остается в списке ожидающих (PEL)
+// группы, пока воркер его не подтвердит, поэтому падение воркера не теряет задачу.
+
+const (
+	// ConsumerGroup группа потребителей, общая для всех воркеров.
+	ConsumerGroup = "geocore"
+	// DeadLettersKey поток задач, от которых воркер отказался (общий для всех очередей).
+	DeadLettersKey = "dead_letters"
+	// dequeueBlock сколько Dequeue ждет новую задачу, прежде чем вернуть управление.
+	dequeueBlock = 5 * time.Second
+)
+
+// streamKey ключ потока для очереди. Отличается от имени очереди, чтобы не конфликтовать
+// со списками, которые использовались для очередей раньше (их содержимое переносит DrainLegacyQueue).
+func streamKey(queueName string) string {
+	return queueName + ":stream"
+}
+
+// drainLegacyScript переносит до ARGV[1] задач из списка очереди прежней версии (LPUSH/BRPOP) в ее поток,
+// начиная с самых старых. Ключ другого типа не трогается. Выполняется атомарно: задача не теряется и не дублируется.
+var drainLegacyScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok ~= 'list' then
+	return 0
+end
+local n = 0
+while n < tonumber(ARGV[1]) do
+	local payload = redis.call('RPOP', KEYS[1])
+	if not payload then
+		break
+	end
+	redis.call('XADD', KEYS[2], '*', 'payload', payload)
+	n = n + 1
+end
+return n
+`)
+
+// DrainLegacyQueue переносит в поток очереди задачи, оставшиеся в списке с именем очереди от прежней версии,
+// где очередь была списком. Вызывается при запуске, чтобы задачи, поставленные до обновления, не потерялись.
+// Возвращает количество перенесенных задач.
+func (r *RedisRepo) DrainLegacyQueue(ctx context.Context, queueName string) (int, error) {
+	total := 0
+	for {
+		// Пачками, чтобы не блокировать Redis на длинном списке
+		n, err := drainLegacyScript.Run(ctx, r.Client, []string{queueName, streamKey(queueName)}, 1000).Int()
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
+
+// ensureGroup создает группу потребителей для очереди (однократно на процесс).
+func (r *RedisRepo) ensureGroup(ctx context.Context, queueName string) error {
+	if _, ok := r.groups.Load(queueName); ok {
+		return nil
+	}
+	err := r.Client.XGroupCreateMkStream(ctx, streamKey(queueName), ConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	r.groups.Store(queueName, struct{}{})
+	return nil
+}
 
-// Enqueue добавляет задачу в очередь списка (LPush).
+// Enqueue добавляет задачу в поток очереди (XADD).
 func (r *RedisRepo) Enqueue(ctx context.Context, queueName string, payload interface{}) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	return r.Client.LPush(ctx, queueName, data).Err()
+	return r.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(queueName),
+		Values: map[string]interface{}{"payload": data},
+	}).Err()
+}
+
+// Dequeue получает новую задачу для этого воркера (XREADGROUP).
+// Возвращает nil, если за время ожидания задач не появилось.
+func (r *RedisRepo) Dequeue(ctx context.Context, queueName string) (*entity.QueueTask, error) {
+	if err := r.ensureGroup(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	streams, err := r.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    ConsumerGroup,
+		Consumer: r.Consumer,
+		Streams:  []string{streamKey(queueName), ">"},
+		Count:    1,
+		Block:    dequeueBlock,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, nil
+	}
+	return toQueueTask(streams[0].Messages[0]), nil
+}
+
+// Ack подтверждает обработку задачи и удаляет ее из потока.
+func (r *RedisRepo) Ack(ctx context.Context, queueName string, taskID string) error {
+	pipe := r.Client.TxPipeline()
+	pipe.XAck(ctx, streamKey(queueName), ConsumerGroup, taskID)
+	pipe.XDel(ctx, streamKey(queueName), taskID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Reclaim забирает себе задачи, которые другие воркеры получили, но не подтвердили дольше minIdle (XAUTOCLAIM).
+func (r *RedisRepo) Reclaim(ctx context.Context, queueName string, minIdle time.Duration, count int) ([]*entity.QueueTask, error) {
+	if err := r.ensureGroup(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	messages, _, err := r.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   streamKey(queueName),
+		Group:    ConsumerGroup,
+		Consumer: r.Consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    int64(count),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*entity.QueueTask, 0, len(messages))
+	for _, m := range messages {
+		tasks = append(tasks, toQueueTask(m))
+	}
+	return tasks, nil
+}
+
+// DeadLetter перемещает задачу в поток недоставленных и подтверждает ее в исходной очереди.
+func (r *RedisRepo) DeadLetter(ctx context.Context, queueName string, task *entity.QueueTask, reason string) error {
+	pipe := r.Client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: DeadLettersKey,
+		Values: map[string]interface{}{
+			"queue":     queueName,
+			"task_id":   task.ID,
+			"payload":   task.Payload,
+			"reason":    reason,
+			"failed_at": time.Now().Format(time.RFC3339Nano),
+		},
+	})
+	pipe.XAck(ctx, streamKey(queueName), ConsumerGroup, task.ID)
+	pipe.XDel(ctx, streamKey(queueName), task.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// scheduledKey ключ отсортированного множества задач, отложенных до следующей попытки (score — время в мс).
+func scheduledKey(queueName string) string {
+	return queueName + ":scheduled"
+}
+
+// Retry откладывает повторную обработку задачи до момента at: новая версия задачи (payload)
+// попадает в отсортированное множество, а текущая подтверждается в очереди — атомарно.
+// Элемент множества — ID сообщения потока и payload через пробел: ID уникален, поэтому одинаковые payload
+// разных задач не схлопываются в один элемент.
+func (r *RedisRepo) Retry(ctx context.Context, queueName string, task *entity.QueueTask, payload interface{}, at time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.Client.TxPipeline()
+	pipe.ZAdd(ctx, scheduledKey(queueName), redis.Z{Score: float64(at.UnixMilli()), Member: task.ID + " " + string(data)})
+	pipe.XAck(ctx, streamKey(queueName), ConsumerGroup, task.ID)
+	pipe.XDel(ctx, streamKey(queueName), task.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// promoteDueScript переносит наступившие задачи из множества отложенных в поток очереди, отбрасывая ID из элемента.
+// Элементы, записанные до появления ID, начинаются сразу с JSON и переносятся как есть.
+// Выполняется атомарно, поэтому несколько экземпляров воркера не продублируют задачу.
+var promoteDueScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, m in ipairs(due) do
+	local payload = m
+	if string.sub(m, 1, 1) ~= '{' then
+		payload = string.sub(m, string.find(m, ' ', 1, true) + 1)
+	end
+	redis.call('XADD', KEYS[2], '*', 'payload', payload)
+	redis.call('ZREM', KEYS[1], m)
+end
+return #due
+`)
+
+// PromoteDue возвращает в очередь отложенные задачи, время попытки которых наступило. Возвращает их количество.
+func (r *RedisRepo) PromoteDue(ctx context.Context, queueName string, limit int) (int, error) {
+	keys := []string{scheduledKey(queueName), streamKey(queueName)}
+	return promoteDueScript.Run(ctx, r.Client, keys, time.Now().UnixMilli(), limit).Int()
+}
+
+// ListDeadLetters возвращает последние недоставленные задачи (новые первыми).
+func (r *RedisRepo) ListDeadLetters(ctx context.Context, limit int) ([]*entity.DeadLetter, error) {
+	messages, err := r.Client.XRevRangeN(ctx, DeadLettersKey, "+", "-", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]*entity.DeadLetter, 0, len(messages))
+	for _, m := range messages {
+		letters = append(letters, toDeadLetter(m))
+	}
+	return letters, nil
 }
 
-// Dequeue извлекает задачу из очереди (BRPop - блокирующее чтение).
-func (r *RedisRepo) Dequeue(ctx context.Context, queueName string) (string, error) {
-	// BRPop блокирует выполнение, пока не появится элемент. 0 - бесконечное ожидание.
-	result, err := r.Client.BRPop(ctx, 0, queueName).Result()
+// ReplayDeadLetter возвращает недоставленную задачу в ее исходную очередь.
+func (r *RedisRepo) ReplayDeadLetter(ctx context.Context, id string) error {
+	messages, err := r.Client.XRange(ctx, DeadLettersKey, id, id).Result()
 	if err != nil {
-		return "", err
+		return err
+	}
+	if len(messages) == 0 {
+		return errors.New("not found")
+	}
+	letter := toDeadLetter(messages[0])
+
+	pipe := r.Client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(letter.Queue),
+		Values: map[string]interface{}{"payload": string(letter.Payload)},
+	})
+	pipe.XDel(ctx, DeadLettersKey, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// toQueueTask преобразует сообщение потока в задачу.
+func toQueueTask(m redis.XMessage) *entity.QueueTask {
+	payload, _ := m.Values["payload"].(string)
+	return &entity.QueueTask{ID: m.ID, Payload: payload}
+}
+
+// toDeadLetter преобразует сообщение потока недоставленных задач.
+func toDeadLetter(m redis.XMessage) *entity.DeadLetter {
+	field := func(name string) string {
+		v, _ := m.Values[name].(string)
+		return v
 	}
-	// result содержит [имя_очереди, значение]
-	if len(result) < 2 {
-		return "", fmt.Errorf("redis pop unexpected result")
+	failedAt, _ := time.Parse(time.RFC3339Nano, field("failed_at"))
+	return &entity.DeadLetter{
+		ID:       m.ID,
+		Queue:    field("queue"),
+		TaskID:   field("task_id"),
+		Payload:  json.RawMessage(field("payload")),
+		Reason:   field("reason"),
+		FailedAt: failedAt,
 	}
-	return result[1], nil
 }
 
 // Cache (Кеш)
 
 const IncidentsCacheKey = "active_incidents"
 
-// SetIncidents сохраняет список инцидентов в кеш с TTL.
-func (r *RedisRepo) SetIncidents(ctx context.Context, incidents []*entity.Incident) error {
+// IncidentsChangedChannel канал pub/sub, в который публикуются изменения инцидентов.
+const IncidentsChangedChannel = "incidents_changed"
+
+// IncidentsVersionKey счетчик поколений кеша инцидентов: увеличивается при каждой инвалидации.
+const IncidentsVersionKey = "active_incidents:version"
+
+// setIncidentsScript записывает кеш, только если с момента чтения версии не было инвалидации:
+// иначе список, прочитанный из БД до изменения, перезаписал бы уже сброшенный кеш.
+var setIncidentsScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[2] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[3])
+return 1
+`)
+
+// SetIncidents сохраняет список инцидентов в кеш с TTL, если версия кеша все еще равна version.
+func (r *RedisRepo) SetIncidents(ctx context.Context, incidents []*entity.Incident, version int64) error {
 	data, err := json.Marshal(incidents)
 	if err != nil {
 		return err
 	}
 	// TTL настроен на 60 секунд.
-	return r.Client.Set(ctx, IncidentsCacheKey, data, 60*time.Second).Err()
+	keys := []string{IncidentsCacheKey, IncidentsVersionKey}
+	return setIncidentsScript.Run(ctx, r.Client, keys, data, version, 60).Err()
+}
+
+// IncidentsVersion возвращает текущую версию кеша инцидентов (0, если инвалидаций еще не было).
+func (r *RedisRepo) IncidentsVersion(ctx context.Context) (int64, error) {
+	version, err := r.Client.Get(ctx, IncidentsVersionKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
 }
 
 // GetIncidents получает список инцидентов из кеша.
@@ -93,3 +374,219 @@ func (r *RedisRepo) GetIncidents(ctx context.Context) ([]*entity.Incident, error
 	}
 	return incidents, nil
 }
+
+// InvalidateIncidents удаляет кеш инцидентов, увеличивает его версию
+// и публикует уведомление для всех экземпляров сервиса.
+func (r *RedisRepo) InvalidateIncidents(ctx context.Context) error {
+	pipe := r.Client.TxPipeline()
+	pipe.Incr(ctx, IncidentsVersionKey)
+	pipe.Del(ctx, IncidentsCacheKey)
+	pipe.Publish(ctx, IncidentsChangedChannel, time.Now().UnixNano())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SubscribeInvalidations подписывается на уведомления об изменении инцидентов.
+// Несколько уведомлений, пришедших подряд, схлопываются в одно.
+func (r *RedisRepo) SubscribeInvalidations(ctx context.Context) (<-chan struct{}, error) {
+	sub := r.Client.Subscribe(ctx, IncidentsChangedChannel)
+	// Дожидаемся подтверждения подписки, чтобы не потерять уведомления сразу после старта
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	out := make(chan struct{}, 1)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case out <- struct{}{}:
+				default: // уведомление уже ожидает обработки
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Geofence (Состояние пользователей в зонах)
+
+// geofenceKey ключ хеша с зонами пользователя: поле — ID инцидента, значение — JSON ZoneMembership.
+func geofenceKey(userID string) string {
+	return "geofence:" + userID
+}
+
+// GetMemberships возвращает зоны, в которых находится пользователь.
+func (r *RedisRepo) GetMemberships(ctx context.Context, userID string) (map[int]*entity.ZoneMembership, error) {
+	vals, err := r.Client.HGetAll(ctx, geofenceKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := make(map[int]*entity.ZoneMembership, len(vals))
+	for field, val := range vals {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geofence field %q: %w", field, err)
+		}
+		var m entity.ZoneMembership
+		if err := json.Unmarshal([]byte(val), &m); err != nil {
+			return nil, err
+		}
+		memberships[id] = &m
+	}
+	return memberships, nil
+}
+
+// SetMemberships полностью заменяет состояние пользователя и продлевает его TTL.
+func (r *RedisRepo) SetMemberships(ctx context.Context, userID string, memberships map[int]*entity.ZoneMembership) error {
+	key := geofenceKey(userID)
+	values := make([]interface{}, 0, 2*len(memberships))
+	for id, m := range memberships {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		values = append(values, strconv.Itoa(id), data)
+	}
+
+	pipe := r.Client.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(values) > 0 {
+		pipe.HSet(ctx, key, values...)
+		pipe.Expire(ctx, key, r.GeofenceTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Last locations (Последние местоположения пользователей)
+//
+// Местоположения хранятся в GEO-множестве (элемент — ID пользователя), время последнего местоположения —
+// в отдельном отсортированном множестве. Устаревшие пользователи отсеиваются при чтении и понемногу удаляются при записи.
+
+const (
+	// lastLocationsKey GEO-множество последних местоположений пользователей.
+	lastLocationsKey = "last_locations"
+	// lastSeenKey отсортированное множество времени последнего местоположения (score — время в мс).
+	lastSeenKey = "last_locations:seen"
+	// lastLocationsPruneBatch сколько устаревших пользователей удаляется за одну запись.
+	lastLocationsPruneBatch = 100
+	// maxGeoLatitude предел широты, поддерживаемый GEO-командами Redis.
+	maxGeoLatitude = 85.05112878
+)
+
+// saveLastLocationsScript удаляет часть устаревших пользователей и записывает новые местоположения
+// (ARGV: граница устаревания, размер порции, затем четверки пользователь, долгота, широта, время).
+// Местоположение, более старое, чем сохраненное, пропускается.
+var saveLastLocationsScript = redis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+if #stale > 0 then
+	redis.call('ZREM', KEYS[1], unpack(stale))
+	redis.call('ZREM', KEYS[2], unpack(stale))
+end
+for i = 3, #ARGV, 4 do
+	local seen = redis.call('ZSCORE', KEYS[2], ARGV[i])
+	if not seen or tonumber(seen) <= tonumber(ARGV[i + 3]) then
+		redis.call('GEOADD', KEYS[1], ARGV[i + 1], ARGV[i + 2], ARGV[i])
+		redis.call('ZADD', KEYS[2], ARGV[i + 3], ARGV[i])
+	end
+end
+return #stale
+`)
+
+// SaveLastLocations запоминает местоположения из проверок (GEOADD) вместе с их временем.
+// Точки за пределами широт, поддерживаемых Redis (около полюсов), пропускаются.
+func (r *RedisRepo) SaveLastLocations(ctx context.Context, checks []*entity.LocationCheck) error {
+	args := []interface{}{time.Now().Add(-r.LastLocationTTL).UnixMilli(), lastLocationsPruneBatch}
+	for _, c := range checks {
+		if math.Abs(c.Latitude) > maxGeoLatitude {
+			continue
+		}
+		args = append(args, c.UserID, c.Longitude, c.Latitude, c.PointTime().UnixMilli())
+	}
+	return saveLastLocationsScript.Run(ctx, r.Client, []string{lastLocationsKey, lastSeenKey}, args...).Err()
+}
+
+// searchLastLocations ищет пользователей в круге (GEOSEARCH) и оставляет тех, чье местоположение не старше since.
+func (r *RedisRepo) searchLastLocations(ctx context.Context, lat, lon, meters float64, since time.Time) ([]*entity.UserLocation, error) {
+	found, err := r.Client.GeoSearchLocation(ctx, lastLocationsKey, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{Longitude: lon, Latitude: lat, Radius: meters, RadiusUnit: "m", Sort: "ASC"},
+		WithCoord:      true,
+		WithDist:       true,
+	}).Result()
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+
+	members := make([]string, len(found))
+	for n, l := range found {
+		members[n] = l.Name
+	}
+	seen, err := r.Client.ZMScore(ctx, lastSeenKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*entity.UserLocation, 0, len(found))
+	for n, l := range found {
+		seenAt := time.UnixMilli(int64(seen[n]))
+		if seen[n] == 0 || seenAt.Before(since) {
+			continue
+		}
+		users = append(users, &entity.UserLocation{UserID: l.Name, Latitude: l.Latitude, Longitude: l.Longitude, SeenAt: seenAt, DistanceMeters: l.Dist})
+	}
+	return users, nil
+}
+
+// FindUsersWithin возвращает пользователей с актуальным местоположением не дальше meters от точки (ближайших первыми).
+func (r *RedisRepo) FindUsersWithin(ctx context.Context, lat, lon, meters float64) ([]*entity.UserLocation, error) {
+	return r.searchLastLocations(ctx, lat, lon, meters, time.Now().Add(-r.LastLocationTTL))
+}
+
+// FindLastLocations возвращает пользователей, местоположение которых не старше since и попадает в прямоугольник area.
+// Поиск идет по кругу вокруг центра прямоугольника, проходящему через его углы.
+func (r *RedisRepo) FindLastLocations(ctx context.Context, area entity.BBox, since time.Time) ([]*entity.LocationCheck, error) {
+	maxLon := area.MaxLon
+	if area.MinLon > area.MaxLon {
+		maxLon += 360 // через антимеридиан
+	}
+	// Центр — в пределах широт, поддерживаемых GEOSEARCH; радиус считается от него же
+	lat := max(min((area.MinLat+area.MaxLat)/2, maxGeoLatitude), -maxGeoLatitude)
+	lon := (area.MinLon + maxLon) / 2
+	if lon > 180 {
+		lon -= 360
+	}
+	// Для прямоугольника уже полушария самая дальняя от центра точка — один из углов
+	var radius float64
+	for _, corner := range [][2]float64{{area.MinLat, area.MinLon}, {area.MinLat, maxLon}, {area.MaxLat, area.MinLon}, {area.MaxLat, maxLon}} {
+		radius = max(radius, entity.DistanceMeters(lat, lon, corner[0], corner[1]))
+	}
+
+	users, err := r.searchLastLocations(ctx, lat, lon, radius*1.01, since)
+	if err != nil {
+		return nil, err
+	}
+	checks := make([]*entity.LocationCheck, 0, len(users))
+	for _, u := range users {
+		inLon := u.Longitude >= area.MinLon && u.Longitude <= area.MaxLon
+		if area.MinLon > area.MaxLon {
+			inLon = u.Longitude >= area.MinLon || u.Longitude <= area.MaxLon
+		}
+		if u.Latitude >= area.MinLat && u.Latitude <= area.MaxLat && inLon {
+			checks = append(checks, &entity.LocationCheck{UserID: u.UserID, Latitude: u.Latitude, Longitude: u.Longitude, CheckedAt: u.SeenAt})
+		}
+	}
+	return checks, nil
+}
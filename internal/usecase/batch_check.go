@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// snapshotIndex возвращает индекс для пакетной проверки. В отличие от currentIndex, при холодном кеше
+// индекс строится синхронно: запрос в БД на каждую точку пакета обошелся бы дороже.
+func (s *GeoService) snapshotIndex(ctx context.Context) (*spatialIndex, error) {
+	idx, err := s.currentIndex(ctx)
+	if err != nil || idx != nil {
+		return idx, err
+	}
+	generation := s.generation.Load()
+	incidents, err := s.loadFromRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.storeIndex(incidents, generation), nil
+}
+
+// CheckLocations проверяет пакет точек по одному снимку активных инцидентов.
+// Возвращает совпавшие зоны для каждой точки в порядке входных данных.
+// Проверки, совпадения и события сохраняются одной транзакцией; точки одного пользователя
+// обрабатываются в порядке времени, поэтому переходы геофенсинга внутри пакета не теряются.
+func (s *GeoService) CheckLocations(ctx context.Context, points []entity.LocationPoint) ([][]*entity.Incident, error) {
+	idx, err := s.snapshotIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make([][]*entity.Incident, len(points))
+	checks := make([]*entity.LocationCheck, len(points))
+	matchIDs := make([][]int, len(points))
+	times := make([]time.Time, len(points)) // время точек (без указанного — время проверки)
+	for n, p := range points {
+		times[n] = p.Timestamp
+		if times[n].IsZero() {
+			times[n] = now
+		}
+		for _, i := range idx.query(p.Latitude, p.Longitude) {
+			if incidentActiveAt(i, now) {
+				results[n] = append(results[n], i)
+				matchIDs[n] = append(matchIDs[n], i.ID)
+			}
+		}
+		// В checked_at — время получения: журнал и статистика не зависят от часов клиента
+		checks[n] = &entity.LocationCheck{UserID: p.UserID, Latitude: p.Latitude, Longitude: p.Longitude, CheckedAt: now}
+		if !p.Timestamp.IsZero() {
+			checks[n].RecordedAt = &p.Timestamp
+		}
+	}
+
+	// Порядок обработки: по пользователю, затем по времени точки
+	order := make([]int, len(points))
+	for n := range order {
+		order[n] = n
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Or(cmp.Compare(points[a].UserID, points[b].UserID), times[a].Compare(times[b]))
+	})
+
+	var events []entity.WebhookEvent
+	states := make(map[string]map[int]*entity.ZoneMembership) // измененное состояние геофенсинга по пользователям
+	for start := 0; start < len(order); {
+		userID := points[order[start]].UserID
+		end := start
+		for end < len(order) && points[order[end]].UserID == userID {
+			end++
+		}
+
+		var prev map[int]*entity.ZoneMembership
+		geofence := s.Geofence != nil
+		if geofence {
+			var err error
+			if prev, err = s.Geofence.GetMemberships(ctx, userID); err != nil {
+				// Как и в CheckLocation: без состояния лучше повторно уведомить, чем потерять события
+				log.Printf("Failed to load geofence state for user %s, falling back to danger_zone_detected: %v", userID, err)
+				geofence = false
+			}
+		}
+		if !geofence {
+			for _, n := range order[start:end] {
+				events = append(events, detectedEvents(userID, results[n], times[n])...)
+			}
+		} else {
+			for _, n := range order[start:end] {
+				userEvents, next := s.transitionEvents(ctx, userID, prev, results[n], nil, times[n])
+				if next != nil {
+					events = append(events, userEvents...)
+					prev = next
+					states[userID] = next
+				}
+			}
+		}
+		start = end
+	}
+
+	outbox, err := outboxMessages(s.QueueName, events)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.LocationRepo.SaveLocationChecks(ctx, checks, matchIDs, outbox); err != nil {
+		return nil, err
+	}
+	s.saveLastLocations(ctx, checks)
+
+	for userID, next := range states {
+		if err := s.Geofence.SetMemberships(ctx, userID, next); err != nil {
+			log.Printf("Failed to save geofence state for user %s: %v", userID, err)
+		}
+	}
+	return results, nil
+}
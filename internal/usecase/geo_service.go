@@ -2,8 +2,11 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
 	"log"
-	"math"
+	"maps"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/paincake00/geocore/internal/entity"
@@ -16,102 +19,359 @@ type GeoService struct {
 	Queue        QueueRepository
 	Cache        IncidentCache
 	QueueName    string
+
+	// Geofence хранилище состояния пользователей в зонах. Если задано, вместо danger_zone_detected
+	// на каждую проверку отправляются только переходы: zone_entered, zone_exited и zone_dwell.
+	Geofence GeofenceStateRepository
+	// DwellTime время пребывания в зоне, после которого отправляется zone_dwell (0 — не отправлять).
+	DwellTime time.Duration
+
+	// LastLocations хранилище последних местоположений пользователей (nil — не ведется).
+	LastLocations LastLocationStore
+
+	// IndexRefreshInterval сколько локальный пространственный индекс считается актуальным,
+	// прежде чем будет перестроен из кеша.
+	IndexRefreshInterval time.Duration
+
+	index      atomic.Pointer[indexSnapshot]
+	generation atomic.Uint64 // увеличивается при каждом сбросе индекса
+	indexMu    sync.Mutex    // не дает нескольким запросам перестраивать индекс одновременно
+	refreshing atomic.Bool   // идет фоновая перестройка индекса
+}
+
+// indexSnapshot локальная копия активных инцидентов с построенным индексом.
+type indexSnapshot struct {
+	index      *spatialIndex
+	builtAt    time.Time
+	generation uint64 // поколение, на момент начала загрузки которого прочитаны инциденты
+}
+
+// fresh сообщает, можно ли использовать снимок: он не устарел и после его загрузки индекс не сбрасывался.
+func (s *GeoService) fresh(snap *indexSnapshot) bool {
+	return snap != nil && snap.generation == s.generation.Load() && time.Since(snap.builtAt) < s.IndexRefreshInterval
 }
 
 // NewGeoService создает новый экземпляр гео-сервиса.
 func NewGeoService(ir IncidentRepository, lr LocationCheckRepository, q QueueRepository, c IncidentCache) *GeoService {
 	return &GeoService{
-		IncidentRepo: ir,
-		LocationRepo: lr,
-		Queue:        q,
-		Cache:        c,
-		QueueName:    "webhook_tasks", // имя очереди задач
+		IncidentRepo:         ir,
+		LocationRepo:         lr,
+		Queue:                q,
+		Cache:                c,
+		QueueName:            "webhook_tasks", // имя очереди задач
+		IndexRefreshInterval: 5 * time.Second,
 	}
 }
 
-// distanceMeters вычисляет расстояние между двумя точками в метрах, используя формулу Хаверсина (Haversine).
-func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371000 // Радиус Земли в метрах
-	phi1 := lat1 * math.Pi / 180
-	phi2 := lat2 * math.Pi / 180
-	deltaPhi := (lat2 - lat1) * math.Pi / 180
-	deltaLambda := (lon2 - lon1) * math.Pi / 180
+// InvalidateIndex сбрасывает локальный индекс: следующая проверка перестроит его из кеша или БД.
+func (s *GeoService) InvalidateIndex() {
+	s.generation.Add(1)
+	s.index.Store(nil)
+}
 
-	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
-		math.Cos(phi1)*math.Cos(phi2)*
-			math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+// WatchInvalidations сбрасывает локальный индекс при каждом уведомлении об изменении инцидентов
+// (в том числе от других экземпляров сервиса). Блокируется до отмены контекста.
+func (s *GeoService) WatchInvalidations(ctx context.Context) {
+	for ctx.Err() == nil {
+		notifications, err := s.Cache.SubscribeInvalidations(ctx)
+		if err != nil {
+			log.Printf("Failed to subscribe to incident invalidations: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second): // пауза перед повторной подпиской
+			}
+			continue
+		}
+		// Пока подписки не было, изменения могли быть пропущены
+		s.InvalidateIndex()
 
-	return R * c
+		for range notifications {
+			s.InvalidateIndex()
+		}
+	}
 }
 
-// CheckLocation проверяет, находится ли пользователь с данными координатами внутри какой-либо активной зоны инцидента.
-func (s *GeoService) CheckLocation(ctx context.Context, userID string, lat, lon float64) ([]*entity.Incident, error) {
-	// 1. Получаем активные инциденты (сначала из кеша, потом из БД)
-	var incidents []*entity.Incident
-	var err error
+// currentIndex возвращает актуальный пространственный индекс, при необходимости перестраивая его.
+// Индекс, устаревший только по времени, возвращается сразу, а перестраивается в фоне; проверки ждут
+// перестройки, лишь если индекса нет или инциденты изменились после его загрузки.
+// Если кеш пуст, а хранилище умеет искать зоны само (SpatialIncidentRepository), возвращает nil:
+// вызывающий выполняет запрос в БД, а индекс прогревается в фоне.
+func (s *GeoService) currentIndex(ctx context.Context) (*spatialIndex, error) {
+	snap := s.index.Load()
+	if s.fresh(snap) {
+		return snap.index, nil
+	}
+	if snap != nil && snap.generation == s.generation.Load() {
+		s.refreshIndexAsync()
+		return snap.index, nil
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
 
-	incidents, err = s.Cache.GetIncidents(ctx)
+	// Индекс мог быть перестроен, пока мы ждали блокировку
+	if snap := s.index.Load(); s.fresh(snap) {
+		return snap.index, nil
+	}
+
+	generation := s.generation.Load()
+	incidents, err := s.Cache.GetIncidents(ctx)
 	if err != nil || incidents == nil {
-		// Кеш пуст или вернул ошибку, идем в базу
-		incidents, err = s.IncidentRepo.GetAllActive(ctx)
+		// Кеш пуст или вернул ошибку
+		if _, ok := s.IncidentRepo.(SpatialIncidentRepository); ok {
+			s.refreshIndexAsync()
+			return nil, nil
+		}
+		// Идем в базу
+		incidents, err = s.loadFromRepo(ctx)
 		if err != nil {
 			return nil, err
 		}
-		// Заполняем кеш
-		_ = s.Cache.SetIncidents(ctx, incidents)
 	}
 
-	// 2. Фильтруем инциденты по расстоянию
+	return s.storeIndex(incidents, generation), nil
+}
+
+// scheduledLookahead насколько вперед в кеш попадают запланированные инциденты. Должен превышать TTL кеша:
+// иначе инцидент, начавшийся, пока список лежит в кеше, не участвовал бы в проверках до его истечения.
+const scheduledLookahead = 5 * time.Minute
+
+// loadFromRepo загружает из БД активные и скоро начинающиеся инциденты и заполняет кеш.
+// Еще не начавшиеся отсекаются при проверке (incidentActiveAt).
+func (s *GeoService) loadFromRepo(ctx context.Context) ([]*entity.Incident, error) {
+	// Версию читаем до запроса в БД: если инциденты изменятся во время загрузки,
+	// устаревший список не попадет в кеш
+	version, versionErr := s.Cache.IncidentsVersion(ctx)
+	until := time.Now().Add(scheduledLookahead + s.IndexRefreshInterval)
+	incidents, err := s.IncidentRepo.GetActiveOrScheduled(ctx, until)
+	if err != nil {
+		return nil, err
+	}
+	// Заполняем кеш
+	if versionErr == nil {
+		_ = s.Cache.SetIncidents(ctx, incidents, version)
+	}
+	return incidents, nil
+}
+
+// storeIndex строит индекс по инцидентам и делает его текущим.
+// generation — поколение на момент начала загрузки: если индекс с тех пор сбрасывался,
+// снимок не будет считаться актуальным и следующая проверка перестроит его.
+func (s *GeoService) storeIndex(incidents []*entity.Incident, generation uint64) *spatialIndex {
+	idx := newSpatialIndex(incidents, defaultCellSizeDeg)
+	s.index.Store(&indexSnapshot{index: idx, builtAt: time.Now(), generation: generation})
+	return idx
+}
+
+// refreshIndexAsync в фоне перестраивает индекс из кеша, а если кеш пуст — из БД с заполнением кеша
+// (не более одной перестройки одновременно). indexMu не берется: проверки не ждут фоновую загрузку.
+func (s *GeoService) refreshIndexAsync() {
+	if !s.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.refreshing.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		generation := s.generation.Load()
+		incidents, err := s.Cache.GetIncidents(ctx)
+		if err != nil || incidents == nil {
+			if incidents, err = s.loadFromRepo(ctx); err != nil {
+				log.Printf("Failed to refresh incidents index: %v", err)
+				return
+			}
+		}
+		s.storeIndex(incidents, generation)
+	}()
+}
+
+// findMatches возвращает зоны, в которые попадает точка: по локальному индексу или запросом в БД при холодном кеше.
+func (s *GeoService) findMatches(ctx context.Context, lat, lon float64) ([]*entity.Incident, error) {
+	idx, err := s.currentIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return s.IncidentRepo.(SpatialIncidentRepository).FindContaining(ctx, lat, lon)
+	}
+
+	// Инцидент мог истечь, пока находился в кеше
+	now := time.Now()
 	var matches []*entity.Incident
-	for _, i := range incidents {
-		dist := distanceMeters(lat, lon, i.Latitude, i.Longitude)
-		if dist <= float64(i.RadiusMeters) {
+	for _, i := range idx.query(lat, lon) {
+		if incidentActiveAt(i, now) {
 			matches = append(matches, i)
 		}
 	}
+	return matches, nil
+}
 
-	// 3. Асинхронная обработка (лог в БД + отправка в очередь)
-	// Мы создаем новый контекст, чтобы асинхронная операция не прервалась, если HTTP-запрос отменится.
-	go func(uID string, latitude, longitude float64, found []*entity.Incident) {
-		asyncCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+// CheckLocation проверяет, находится ли пользователь с данными координатами внутри какой-либо активной зоны инцидента.
+func (s *GeoService) CheckLocation(ctx context.Context, userID string, lat, lon float64) ([]*entity.Incident, error) {
+	matches, _, err := s.CheckLocationWithWarnings(ctx, userID, lat, lon, 0)
+	return matches, err
+}
+
+// CheckLocationWithWarnings проверяет местоположение как CheckLocation и дополнительно возвращает зоны,
+// до границы которых не больше bufferMeters (0 — без предупреждений), с отправкой zone_approaching.
+func (s *GeoService) CheckLocationWithWarnings(ctx context.Context, userID string, lat, lon, bufferMeters float64) ([]*entity.Incident, []*ProximityWarning, error) {
+	// 1-2. Находим зоны, содержащие точку: по локальному индексу активных инцидентов
+	// (строится из кеша или БД) либо запросом в PostGIS, пока кеш холодный
+	var matches []*entity.Incident
+	var warnings []*ProximityWarning
+	var err error
+	if bufferMeters > 0 {
+		matches, warnings, err = s.findNearby(ctx, lat, lon, bufferMeters)
+	} else {
+		matches, err = s.findMatches(ctx, lat, lon)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 3. Сохраняем проверку, совпадения и события в одной транзакции (transactional outbox).
+	// В очередь события публикует ретранслятор outbox, поэтому они не теряются,
+	// если Redis недоступен или процесс завершится сразу после ответа.
+	now := time.Now()
+	events, next := s.buildEvents(ctx, userID, matches, warnings, now)
+
+	outbox, err := outboxMessages(s.QueueName, events)
+	if err != nil {
+		return nil, nil, err
+	}
+	incidentIDs := make([]int, 0, len(matches))
+	for _, incident := range matches {
+		incidentIDs = append(incidentIDs, incident.ID)
+	}
+
+	check := &entity.LocationCheck{UserID: userID, Latitude: lat, Longitude: lon}
+	if err := s.LocationRepo.SaveLocationCheck(ctx, check, incidentIDs, outbox); err != nil {
+		return nil, nil, err
+	}
+	s.saveLastLocations(ctx, []*entity.LocationCheck{check})
 
-		check := &entity.LocationCheck{
-			UserID:    uID,
-			Latitude:  latitude,
-			Longitude: longitude,
+	// Состояние геофенсинга сохраняется после событий: при сбое переход повторится при следующей проверке,
+	// но не потеряется
+	if next != nil {
+		if err := s.Geofence.SetMemberships(ctx, userID, next); err != nil {
+			log.Printf("Failed to save geofence state for user %s: %v", userID, err)
 		}
+	}
 
-		// Сохраняем факт проверки
-		if err := s.LocationRepo.CreateLocationCheck(asyncCtx, check); err != nil {
-			log.Printf("Failed to create location check: %v", err)
-			return
+	return matches, warnings, nil
+}
+
+// GetLocationChecks возвращает страницу журнала проверок местоположения (новые первыми).
+func (s *GeoService) GetLocationChecks(ctx context.Context, f entity.CheckFilter) (entity.Page[*entity.LocationCheck], error) {
+	limit := f.Limit
+	f.Limit = limit + 1 // лишняя запись показывает, есть ли следующая страница
+	checks, err := s.LocationRepo.GetLocationChecks(ctx, f)
+	if err != nil {
+		return entity.Page[*entity.LocationCheck]{}, err
+	}
+	return entity.NewPage(checks, limit, func(c *entity.LocationCheck) entity.Cursor {
+		return entity.Cursor{Time: c.CheckedAt, ID: int64(c.ID)}
+	}), nil
+}
+
+// outboxMessages преобразует события в сообщения outbox для очереди queue.
+func outboxMessages(queue string, events []entity.WebhookEvent) ([]*entity.OutboxMessage, error) {
+	outbox := make([]*entity.OutboxMessage, 0, len(events))
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
 		}
+		outbox = append(outbox, &entity.OutboxMessage{Queue: queue, Payload: payload})
+	}
+	return outbox, nil
+}
 
-		for _, incident := range found {
-			// Записываем совпадение (пользователь попал в зону)
-			if err := s.LocationRepo.RecordIncidentMatch(asyncCtx, check.ID, incident.ID); err != nil {
-				log.Printf("Failed to record incident match: %v", err)
-				continue
-			}
+// buildEvents формирует события для найденных зон и зон, к которым приближается пользователь.
+// Без геофенсинга на каждое совпадение отправляется danger_zone_detected, а на каждое предупреждение — zone_approaching,
+// с геофенсингом — только переходы относительно сохраненного состояния пользователя.
+// Также возвращает новое состояние геофенсинга, которое нужно сохранить (nil — состояние не изменилось).
+func (s *GeoService) buildEvents(ctx context.Context, userID string, found []*entity.Incident, nearby []*ProximityWarning, now time.Time) ([]entity.WebhookEvent, map[int]*entity.ZoneMembership) {
+	if s.Geofence == nil {
+		return statelessEvents(userID, found, nearby, now), nil
+	}
 
-			// Ставим задачу в очередь
-			payload := entity.WebhookEvent{
-				Event:                "danger_zone_detected",
-				UserID:               uID,
-				IncidentID:           incident.ID,
-				IncidentLatitude:     incident.Latitude,
-				IncidentLongitude:    incident.Longitude,
-				IncidentRadiusMeters: incident.RadiusMeters,
-				DetectedAt:           time.Now().Format(time.RFC3339),
-			}
+	prev, err := s.Geofence.GetMemberships(ctx, userID)
+	if err != nil {
+		// Без состояния переходы не вычислить: лучше повторно уведомить, чем потерять вход в зону
+		log.Printf("Failed to load geofence state for user %s, falling back to danger_zone_detected: %v", userID, err)
+		return statelessEvents(userID, found, nearby, now), nil
+	}
+	return s.transitionEvents(ctx, userID, prev, found, nearby, now)
+}
+
+// statelessEvents формирует события без учета состояния геофенсинга:
+// danger_zone_detected на каждое совпадение и zone_approaching на каждую близкую зону.
+func statelessEvents(userID string, found []*entity.Incident, nearby []*ProximityWarning, now time.Time) []entity.WebhookEvent {
+	events := detectedEvents(userID, found, now)
+	for _, w := range nearby {
+		e := newZoneEvent(entity.EventZoneApproaching, userID, w.Incident, now)
+		e.DistanceMeters, e.BearingDegrees = w.DistanceMeters, w.BearingDegrees
+		events = append(events, e)
+	}
+	return events
+}
 
-			if err := s.Queue.Enqueue(asyncCtx, s.QueueName, payload); err != nil {
-				log.Printf("Failed to enqueue webhook task: %v", err)
+// detectedEvents формирует danger_zone_detected на каждое совпадение (без геофенсинга).
+func detectedEvents(userID string, found []*entity.Incident, now time.Time) []entity.WebhookEvent {
+	events := make([]entity.WebhookEvent, 0, len(found))
+	for _, incident := range found {
+		events = append(events, newZoneEvent(entity.EventDangerZoneDetected, userID, incident, now))
+	}
+	return events
+}
+
+// transitionEvents формирует события переходов относительно состояния prev.
+// Возвращает новое состояние (nil — состояние не изменилось).
+func (s *GeoService) transitionEvents(ctx context.Context, userID string, prev map[int]*entity.ZoneMembership, found []*entity.Incident, nearby []*ProximityWarning, now time.Time) ([]entity.WebhookEvent, map[int]*entity.ZoneMembership) {
+	transitions, next := geofenceTransitions(prev, found, nearby, now, s.DwellTime)
+	if len(transitions) == 0 {
+		// Уход из буфера предупреждения не порождает событий, но состояние нужно сохранить
+		if maps.EqualFunc(prev, next, func(a, b *entity.ZoneMembership) bool { return a == b }) {
+			return nil, nil
+		}
+		return nil, next
+	}
+
+	events := make([]entity.WebhookEvent, 0, len(transitions))
+	for _, t := range transitions {
+		incident := t.Incident
+		if incident == nil {
+			// Зона, из которой вышел пользователь, могла быть удалена
+			if i, err := s.IncidentRepo.GetByID(ctx, t.IncidentID); err == nil {
+				incident = i
+			} else {
+				incident = &entity.Incident{ID: t.IncidentID}
 			}
 		}
-	}(userID, lat, lon, matches)
+		e := newZoneEvent(t.Event, userID, incident, now)
+		e.DwellSeconds = int(t.Dwell.Seconds())
+		if t.Warning != nil {
+			e.DistanceMeters, e.BearingDegrees = t.Warning.DistanceMeters, t.Warning.BearingDegrees
+		}
+		events = append(events, e)
+	}
+	return events, next
+}
 
-	return matches, nil
+// newZoneEvent формирует событие вебхука о пользователе и зоне инцидента.
+func newZoneEvent(event, userID string, incident *entity.Incident, now time.Time) entity.WebhookEvent {
+	return entity.WebhookEvent{
+		Event:                event,
+		UserID:               userID,
+		IncidentID:           incident.ID,
+		IncidentLatitude:     incident.Latitude,
+		IncidentLongitude:    incident.Longitude,
+		IncidentRadiusMeters: incident.RadiusMeters,
+		IncidentSeverity:     incident.Severity,
+		IncidentCategory:     incident.Category,
+		DetectedAt:           now.Format(time.RFC3339),
+	}
 }
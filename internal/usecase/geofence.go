@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"slices"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// zoneTransition переход пользователя относительно зоны, о котором нужно сообщить.
+type zoneTransition struct {
+	Event      string
+	IncidentID int
+	Incident   *entity.Incident // nil для выхода из зоны, которой больше нет в наборе активных
+	Dwell      time.Duration
+	Warning    *ProximityWarning // для zone_approaching
+}
+
+// geofenceTransitions сравнивает прежнее состояние пользователя с текущими совпадениями
+// и возвращает переходы (вход, выход, длительное пребывание, приближение) и новое состояние.
+// Событие zone_dwell отправляется один раз за пребывание, когда пользователь находится в зоне не меньше dwellTime.
+// Событие zone_approaching отправляется при попадании в буфер предупреждения (nearby) снаружи,
+// но не после выхода из зоны в ее буфер.
+func geofenceTransitions(prev map[int]*entity.ZoneMembership, current []*entity.Incident, nearby []*ProximityWarning, now time.Time, dwellTime time.Duration) ([]zoneTransition, map[int]*entity.ZoneMembership) {
+	var transitions []zoneTransition
+	next := make(map[int]*entity.ZoneMembership, len(current)+len(nearby))
+
+	for _, i := range current {
+		m, ok := prev[i.ID]
+		if !ok || m.Approaching {
+			transitions = append(transitions, zoneTransition{Event: entity.EventZoneEntered, IncidentID: i.ID, Incident: i})
+			m = &entity.ZoneMembership{EnteredAt: now}
+		}
+		if dwell := now.Sub(m.EnteredAt); dwellTime > 0 && !m.DwellNotified && dwell >= dwellTime {
+			transitions = append(transitions, zoneTransition{Event: entity.EventZoneDwell, IncidentID: i.ID, Incident: i, Dwell: dwell})
+			m = &entity.ZoneMembership{EnteredAt: m.EnteredAt, DwellNotified: true}
+		}
+		next[i.ID] = m
+	}
+
+	for _, w := range nearby {
+		m, ok := prev[w.Incident.ID]
+		if !ok {
+			transitions = append(transitions, zoneTransition{Event: entity.EventZoneApproaching, IncidentID: w.Incident.ID, Incident: w.Incident, Warning: w})
+		}
+		if !ok || !m.Approaching {
+			m = &entity.ZoneMembership{EnteredAt: now, Approaching: true}
+		}
+		next[w.Incident.ID] = m
+	}
+
+	exited := make([]int, 0, len(prev))
+	for id, m := range prev {
+		// Выход из зоны, в том числе в ее буфер предупреждения
+		if n, ok := next[id]; !m.Approaching && (!ok || n.Approaching) {
+			exited = append(exited, id)
+		}
+	}
+	slices.Sort(exited)
+	for _, id := range exited {
+		transitions = append(transitions, zoneTransition{Event: entity.EventZoneExited, IncidentID: id, Dwell: now.Sub(prev[id].EnteredAt)})
+	}
+
+	return transitions, next
+}
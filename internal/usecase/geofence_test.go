@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+func TestGeofenceTransitions(t *testing.T) {
+	zoneA := &entity.Incident{ID: 1}
+	zoneB := &entity.Incident{ID: 2}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	dwell := 5 * time.Minute
+
+	steps := []struct {
+		name    string
+		at      time.Time
+		current []*entity.Incident
+		want    []string
+	}{
+		{"enter A", start, []*entity.Incident{zoneA}, []string{entity.EventZoneEntered}},
+		{"still in A", start.Add(time.Minute), []*entity.Incident{zoneA}, nil},
+		{"dwell in A, enter B", start.Add(6 * time.Minute), []*entity.Incident{zoneA, zoneB}, []string{entity.EventZoneDwell, entity.EventZoneEntered}},
+		{"dwell sent once", start.Add(7 * time.Minute), []*entity.Incident{zoneA, zoneB}, nil},
+		{"exit both", start.Add(8 * time.Minute), nil, []string{entity.EventZoneExited, entity.EventZoneExited}},
+		{"outside", start.Add(9 * time.Minute), nil, nil},
+	}
+
+	state := map[int]*entity.ZoneMembership{}
+	for _, step := range steps {
+		var transitions []zoneTransition
+		transitions, state = geofenceTransitions(state, step.current, nil, step.at, dwell)
+
+		if len(transitions) != len(step.want) {
+			t.Fatalf("%s: expected %v, got %+v", step.name, step.want, transitions)
+		}
+		for n, tr := range transitions {
+			if tr.Event != step.want[n] {
+				t.Errorf("%s: expected event %s at %d, got %s", step.name, step.want[n], n, tr.Event)
+			}
+		}
+	}
+}
+
+func TestGeofenceTransitions_Approaching(t *testing.T) {
+	zone := &entity.Incident{ID: 1}
+	near := []*ProximityWarning{{Incident: zone, DistanceMeters: 100}}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name    string
+		current []*entity.Incident
+		nearby  []*ProximityWarning
+		want    []string
+	}{
+		{"approach", nil, near, []string{entity.EventZoneApproaching}},
+		{"still approaching", nil, near, nil},
+		{"enter", []*entity.Incident{zone}, nil, []string{entity.EventZoneEntered}},
+		{"exit into buffer", nil, near, []string{entity.EventZoneExited}},
+		{"leave buffer", nil, nil, nil},
+		{"approach again", nil, near, []string{entity.EventZoneApproaching}},
+	}
+
+	state := map[int]*entity.ZoneMembership{}
+	for n, step := range steps {
+		var transitions []zoneTransition
+		transitions, state = geofenceTransitions(state, step.current, step.nearby, start.Add(time.Duration(n)*time.Minute), 0)
+
+		if len(transitions) != len(step.want) {
+			t.Fatalf("%s: expected %v, got %+v", step.name, step.want, transitions)
+		}
+		for k, tr := range transitions {
+			if tr.Event != step.want[k] {
+				t.Errorf("%s: expected event %s at %d, got %s", step.name, step.want[k], k, tr.Event)
+			}
+		}
+	}
+}
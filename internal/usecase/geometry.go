@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"math"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// distanceMeters вычисляет расстояние между двумя точками в метрах (см. entity.DistanceMeters).
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	return entity.DistanceMeters(lat1, lon1, lat2, lon2)
+}
+
+// incidentContains проверяет, попадает ли точка в зону инцидента (окружность или полигон).
+func incidentContains(i *entity.Incident, lat, lon float64) bool {
+	if i.Geometry != nil {
+		return geometryContains(i.Geometry, lat, lon)
+	}
+	return distanceMeters(lat, lon, i.Latitude, i.Longitude) <= float64(i.RadiusMeters)
+}
+
+// geometryContains проверяет попадание точки хотя бы в один из полигонов геометрии.
+func geometryContains(g *entity.Geometry, lat, lon float64) bool {
+	for _, p := range g.Polygons {
+		if polygonContains(p, lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// polygonContains проверяет попадание точки во внешний контур полигона и отсутствие попадания в отверстия.
+func polygonContains(p entity.Polygon, lat, lon float64) bool {
+	if len(p) == 0 || !ringContains(p[0], lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains реализует алгоритм трассировки луча (ray casting) на плоскости долгота/широта.
+// Для зон размером до десятков километров погрешность плоской модели пренебрежимо мала.
+func ringContains(r entity.Ring, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i].Lon(), r[i].Lat()
+		xj, yj := r[j].Lon(), r[j].Lat()
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// geometryCenter возвращает центр охватывающего прямоугольника геометрии (широта, долгота).
+func geometryCenter(g *entity.Geometry) (float64, float64) {
+	minLat, minLon := math.Inf(1), math.Inf(1)
+	maxLat, maxLon := math.Inf(-1), math.Inf(-1)
+	for _, p := range g.Polygons {
+		if len(p) == 0 {
+			continue
+		}
+		for _, pos := range p[0] {
+			minLat, maxLat = math.Min(minLat, pos.Lat()), math.Max(maxLat, pos.Lat())
+			minLon, maxLon = math.Min(minLon, pos.Lon()), math.Max(maxLon, pos.Lon())
+		}
+	}
+	if math.IsInf(minLat, 1) {
+		return 0, 0
+	}
+	return (minLat + maxLat) / 2, (minLon + maxLon) / 2
+}
+
+// bearingDegrees вычисляет начальный азимут из первой точки на вторую в градусах (0° — север, по часовой стрелке).
+func bearingDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(deltaLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// distanceToEdge вычисляет расстояние от точки вне зоны до ее границы в метрах и азимут на ближайшую точку границы.
+func distanceToEdge(i *entity.Incident, lat, lon float64) (float64, float64) {
+	if i.Geometry == nil {
+		return distanceMeters(lat, lon, i.Latitude, i.Longitude) - float64(i.RadiusMeters), bearingDegrees(lat, lon, i.Latitude, i.Longitude)
+	}
+
+	// Ближайшая точка каждого ребра ищется в локальной плоской проекции вокруг точки (метры на восток и на север)
+	cosLat := math.Cos(lat * math.Pi / 180)
+	project := func(p entity.Position) (float64, float64) {
+		dLon := math.Remainder(p.Lon()-lon, 360) // ребра рядом с антимеридианом
+		return dLon * metersPerDegree * cosLat, (p.Lat() - lat) * metersPerDegree
+	}
+
+	best, bestX, bestY := math.Inf(1), 0.0, 0.0
+	for _, p := range i.Geometry.Polygons {
+		for _, ring := range p {
+			for n := 0; n+1 < len(ring); n++ {
+				ax, ay := project(ring[n])
+				bx, by := project(ring[n+1])
+				dx, dy := bx-ax, by-ay
+				t := 0.0
+				if l := dx*dx + dy*dy; l > 0 {
+					t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+				}
+				x, y := ax+t*dx, ay+t*dy
+				if d := math.Hypot(x, y); d < best {
+					best, bestX, bestY = d, x, y
+				}
+			}
+		}
+	}
+	if math.IsInf(best, 1) || cosLat < 1e-9 {
+		return best, math.Mod(math.Atan2(bestX, bestY)*180/math.Pi+360, 360)
+	}
+	// Расстояние до найденной точки границы считаем по сфере, как и для окружностей
+	edgeLat, edgeLon := lat+bestY/metersPerDegree, lon+bestX/(metersPerDegree*cosLat)
+	return distanceMeters(lat, lon, edgeLat, edgeLon), bearingDegrees(lat, lon, edgeLat, edgeLon)
+}
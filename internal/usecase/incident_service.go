@@ -2,28 +2,147 @@ package usecase
 
 import (
 	"context"
+	"log"
+	"time"
 
 	"github.com/paincake00/geocore/internal/entity"
 )
 
 // IncidentService отвечает за бизнес-логику управления инцидентами.
 type IncidentService struct {
-	Repo  IncidentRepository
-	Cache IncidentCache
+	Repo      IncidentRepository
+	Cache     IncidentCache
+	QueueName string // очередь, в которую ретранслятор outbox публикует события
+
+	// LastLocations — последние местоположения пользователей для оповещения тех, кто уже находится в новой
+	// или расширенной зоне (nil — отключено). LastLocationMaxAge — насколько свежим должно быть местоположение.
+	LastLocations      LastLocationRepository
+	LastLocationMaxAge time.Duration
+	// Outbox — куда записываются события для уже находящихся в зоне пользователей (nil — оповещение отключено).
+	Outbox OutboxWriter
+	// Geofence — состояние пользователей в зонах (то же, что у GeoService). Если задано, оповещенным пользователям
+	// отправляется zone_entered и запоминается вход, чтобы следующая проверка не сообщила о нем повторно.
+	Geofence GeofenceStateRepository
 }
 
 // NewIncidentService создает новый экземпляр сервиса инцидентов.
 func NewIncidentService(r IncidentRepository, c IncidentCache) *IncidentService {
-	return &IncidentService{Repo: r, Cache: c}
+	return &IncidentService{
+		Repo:      r,
+		Cache:     c,
+		QueueName: "webhook_tasks", // та же очередь, что и в GeoService
+	}
+}
+
+// normalizeIncident приводит инцидент к единому виду: статус по умолчанию active, уровень опасности danger,
+// категория other; для полигональной зоны центр охватывающего прямоугольника записывается в координаты, радиус не используется.
+func normalizeIncident(i *entity.Incident) {
+	if i.Status == "" {
+		i.Status = entity.IncidentStatusActive
+	}
+	if i.Severity == "" {
+		i.Severity = entity.SeverityDanger
+	}
+	if i.Category == "" {
+		i.Category = entity.CategoryOther
+	}
+	if i.Geometry == nil {
+		return
+	}
+	i.Latitude, i.Longitude = geometryCenter(i.Geometry)
+	i.RadiusMeters = 0
+}
+
+// incidentActiveAt проверяет, действует ли инцидент в момент t (статус active и t внутри окна действия).
+func incidentActiveAt(i *entity.Incident, t time.Time) bool {
+	if i.Status != entity.IncidentStatusActive {
+		return false
+	}
+	if i.StartsAt != nil && t.Before(*i.StartsAt) {
+		return false
+	}
+	if i.ExpiresAt != nil && !t.Before(*i.ExpiresAt) {
+		return false
+	}
+	return true
 }
 
-// Create создает новый инцидент.
+// invalidateCache сбрасывает кеш инцидентов и оповещает все экземпляры сервиса.
+// Ошибка не прерывает операцию: запись в БД уже выполнена, а кеш устареет не более чем на свой TTL.
+func (s *IncidentService) invalidateCache(ctx context.Context) {
+	if err := s.Cache.InvalidateIncidents(ctx); err != nil {
+		log.Printf("Failed to invalidate incidents cache: %v", err)
+	}
+}
+
+// incidentEvent формирует событие об инциденте с его зоной, уровнем опасности и категорией.
+func incidentEvent(event string, i *entity.Incident, now time.Time) entity.WebhookEvent {
+	return entity.WebhookEvent{
+		Event:                event,
+		IncidentID:           i.ID,
+		IncidentLatitude:     i.Latitude,
+		IncidentLongitude:    i.Longitude,
+		IncidentRadiusMeters: i.RadiusMeters,
+		IncidentSeverity:     i.Severity,
+		IncidentCategory:     i.Category,
+		DetectedAt:           now.Format(time.RFC3339),
+	}
+}
+
+// lifecycleEvents возвращает функцию, формирующую событие об изменении инцидента оператором с состоянием до и после изменения.
+// Хранилище вызывает ее с записанным инцидентом и сохраняет событие в outbox в транзакции изменения.
+// before — состояние до изменения (nil при создании); при удалении записанный инцидент в событие не попадает,
+// и зона события берется из before.
+func (s *IncidentService) lifecycleEvents(ctx context.Context, event string, before *entity.Incident) entity.OutboxFunc {
+	actor, operator := entity.ActorFromContext(ctx), entity.OperatorFromContext(ctx)
+	return func(written *entity.Incident) ([]*entity.OutboxMessage, error) {
+		after := written
+		if event == entity.EventIncidentDeleted {
+			after = nil
+		}
+		current := after
+		if current == nil {
+			current = before
+		}
+		payload := incidentEvent(event, current, time.Now())
+		// Копии, чтобы событие не зависело от дальнейших изменений переданных инцидентов
+		if before != nil {
+			b := *before
+			payload.Before = &b
+		}
+		if after != nil {
+			a := *after
+			payload.After = &a
+		}
+		payload.Actor, payload.Operator = actor, operator
+		return outboxMessages(s.QueueName, []entity.WebhookEvent{payload})
+	}
+}
+
+// Create создает новый инцидент; событие incident_created записывается в outbox в той же транзакции.
 func (s *IncidentService) Create(ctx context.Context, i *entity.Incident) error {
-	if err := s.Repo.Create(ctx, i); err != nil {
+	normalizeIncident(i)
+	if err := s.Repo.Create(ctx, i, s.lifecycleEvents(ctx, entity.EventIncidentCreated, nil)); err != nil {
 		return err
 	}
-	// Инвалидация или обновление кеша
-	// Для простоты, здесь можно было бы сбросить кеш, чтобы при следующем чтении данные обновились.
+	s.invalidateCache(ctx)
+	s.notifyUsersInside(ctx, nil, i)
+	return nil
+}
+
+// Import создает пачку инцидентов в одной транзакции: либо создаются все, либо ни один.
+// События incident_created по каждому созданному инциденту записываются в outbox в той же транзакции.
+func (s *IncidentService) Import(ctx context.Context, incidents []*entity.Incident) error {
+	for _, i := range incidents {
+		normalizeIncident(i)
+	}
+	if err := s.Repo.CreateBatch(ctx, incidents, s.lifecycleEvents(ctx, entity.EventIncidentCreated, nil)); err != nil {
+		return err
+	}
+	s.invalidateCache(ctx)
+	for _, i := range incidents {
+		s.notifyUsersInside(ctx, nil, i)
+	}
 	return nil
 }
 
@@ -32,30 +151,102 @@ func (s *IncidentService) GetByID(ctx context.Context, id int) (*entity.Incident
 	return s.Repo.GetByID(ctx, id)
 }
 
-// GetAll возвращает список инцидентов с пагинацией.
-func (s *IncidentService) GetAll(ctx context.Context, limit, offset int) ([]*entity.Incident, error) {
-	return s.Repo.GetAll(ctx, limit, offset)
+// GetAll возвращает страницу списка инцидентов с фильтрами и сортировкой.
+// Курсор следующей страницы возвращается только при сортировке по времени создания.
+func (s *IncidentService) GetAll(ctx context.Context, filter entity.IncidentFilter) (entity.Page[*entity.Incident], error) {
+	limit := filter.Limit
+	filter.Limit = limit + 1 // лишняя запись показывает, есть ли следующая страница
+	incidents, err := s.Repo.GetAll(ctx, filter)
+	if err != nil {
+		return entity.Page[*entity.Incident]{}, err
+	}
+
+	page := entity.NewPage(incidents, limit, func(i *entity.Incident) entity.Cursor {
+		return entity.Cursor{Time: i.CreatedAt, ID: int64(i.ID)}
+	})
+	if !filter.KeysetSort() {
+		page.NextCursor = ""
+	}
+	return page, nil
+}
+
+// GetAllActive возвращает все активные инциденты (для выгрузки).
+func (s *IncidentService) GetAllActive(ctx context.Context) ([]*entity.Incident, error) {
+	return s.Repo.GetAllActive(ctx)
 }
 
-// Update обновляет существующий инцидент.
+// Update обновляет существующий инцидент; событие incident_updated с состоянием до и после изменения
+// записывается в outbox в той же транзакции. Если статус не передан, сохраняется текущий.
 func (s *IncidentService) Update(ctx context.Context, i *entity.Incident) error {
-	if err := s.Repo.Update(ctx, i); err != nil {
+	before, err := s.Repo.GetByID(ctx, i.ID)
+	if err != nil {
+		return err
+	}
+	if i.Status == "" {
+		i.Status = before.Status // иначе normalizeIncident вернул бы завершенный инцидент или черновик в active
+	}
+	normalizeIncident(i)
+	if err := s.Repo.Update(ctx, i, s.lifecycleEvents(ctx, entity.EventIncidentUpdated, before)); err != nil {
 		return err
 	}
-	// Логика инвалидации кеша должна быть здесь
+	s.invalidateCache(ctx)
+	s.notifyUsersInside(ctx, before, i)
 	return nil
 }
 
-// Delete удаляет инцидент по ID (или помечает удаленным).
+// Delete помечает инцидент удаленным: он перестает участвовать в проверках, но сохраняется вместе с историей.
+// Событие incident_deleted с последним состоянием инцидента записывается в outbox в той же транзакции.
 func (s *IncidentService) Delete(ctx context.Context, id int) error {
-	if err := s.Repo.Delete(ctx, id); err != nil {
+	before, err := s.Repo.GetByID(ctx, id)
+	if err != nil {
 		return err
 	}
-	// Логика инвалидации кеша должна быть здесь
+	if err := s.Repo.Delete(ctx, id, s.lifecycleEvents(ctx, entity.EventIncidentDeleted, before)); err != nil {
+		return err
+	}
+	s.invalidateCache(ctx)
 	return nil
 }
 
+// GetRevisions возвращает историю изменений инцидента.
+func (s *IncidentService) GetRevisions(ctx context.Context, id int) ([]*entity.IncidentRevision, error) {
+	return s.Repo.GetRevisions(ctx, id)
+}
+
+// RestoreRevision возвращает инцидент к состоянию из ревизии истории (в том числе восстанавливает удаленный).
+// Для существующего инцидента в outbox записывается incident_updated, для восстановленного после удаления — incident_created.
+func (s *IncidentService) RestoreRevision(ctx context.Context, id, revision int) (*entity.Incident, error) {
+	before, _ := s.Repo.GetByID(ctx, id) // nil для удаленного инцидента
+	event := entity.EventIncidentUpdated
+	if before == nil {
+		event = entity.EventIncidentCreated
+	}
+	restored, err := s.Repo.RestoreRevision(ctx, id, revision, s.lifecycleEvents(ctx, event, before))
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateCache(ctx)
+	s.notifyUsersInside(ctx, before, restored)
+	return restored, nil
+}
+
+// ResolveExpired переводит истекшие инциденты в статус resolved; событие incident_resolved по каждому
+// записывается в outbox в той же транзакции. Возвращает количество завершенных инцидентов.
+func (s *IncidentService) ResolveExpired(ctx context.Context) (int, error) {
+	now := time.Now()
+	resolved, err := s.Repo.ExpireIncidents(ctx, func(i *entity.Incident) ([]*entity.OutboxMessage, error) {
+		return outboxMessages(s.QueueName, []entity.WebhookEvent{incidentEvent(entity.EventIncidentResolved, i, now)})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(resolved) > 0 {
+		s.invalidateCache(ctx)
+	}
+	return len(resolved), nil
+}
+
 // GetStats возвращает статистику: сколько пользователей попало в опасные зоны за последние N минут.
-func (s *IncidentService) GetStats(ctx context.Context, windowMinutes int) (map[int]int, error) {
-	return s.Repo.GetStats(ctx, windowMinutes)
+func (s *IncidentService) GetStats(ctx context.Context, windowMinutes int, filter entity.StatsFilter) (map[int]int, error) {
+	return s.Repo.GetStats(ctx, windowMinutes, filter)
 }
@@ -2,35 +2,132 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/paincake00/geocore/internal/entity"
 )
 
 // IncidentRepository интерфейс для работы с хранилищем инцидентов (PostgreSQL).
+// Изменяющие методы принимают events (может быть nil): сообщения outbox по записанному инциденту
+// сохраняются в транзакции изменения.
 type IncidentRepository interface {
-	Create(ctx context.Context, incident *entity.Incident) error
+	Create(ctx context.Context, incident *entity.Incident, events entity.OutboxFunc) error
+	CreateBatch(ctx context.Context, incidents []*entity.Incident, events entity.OutboxFunc) error // Все или ничего (в одной транзакции)
 	GetByID(ctx context.Context, id int) (*entity.Incident, error)
-	GetAll(ctx context.Context, limit, offset int) ([]*entity.Incident, error)
-	GetAllActive(ctx context.Context) ([]*entity.Incident, error) // Для кеширования
-	Update(ctx context.Context, incident *entity.Incident) error
-	Delete(ctx context.Context, id int) error
-	GetStats(ctx context.Context, windowMinutes int) (map[int]int, error) // incident_id -> количество пользователей
+	GetAll(ctx context.Context, filter entity.IncidentFilter) ([]*entity.Incident, error)
+	GetAllActive(ctx context.Context) ([]*entity.Incident, error) // Для выгрузки
+	// GetActiveOrScheduled возвращает действующие инциденты и запланированные с началом не позже until (для кеширования)
+	GetActiveOrScheduled(ctx context.Context, until time.Time) ([]*entity.Incident, error)
+	ExpireIncidents(ctx context.Context, events entity.OutboxFunc) ([]*entity.Incident, error) // Переводит истекшие в resolved
+	Update(ctx context.Context, incident *entity.Incident, events entity.OutboxFunc) error
+	Delete(ctx context.Context, id int, events entity.OutboxFunc) error // Мягкое удаление: инцидент скрывается, история сохраняется
+	// Каждое изменение (включая создание и удаление) записывается ревизией с автором и оператором из контекста
+	// (entity.ActorFromContext, entity.OperatorFromContext).
+	GetRevisions(ctx context.Context, incidentID int) ([]*entity.IncidentRevision, error)
+	RestoreRevision(ctx context.Context, incidentID, revision int, events entity.OutboxFunc) (*entity.Incident, error)
+	GetStats(ctx context.Context, windowMinutes int, filter entity.StatsFilter) (map[int]int, error) // incident_id -> количество пользователей
+}
+
+// SpatialIncidentRepository расширение хранилища инцидентов, умеющее сопоставлять точку с зонами на стороне БД (PostGIS).
+// Используется GeoService, пока кеш инцидентов пуст.
+type SpatialIncidentRepository interface {
+	FindContaining(ctx context.Context, lat, lon float64) ([]*entity.Incident, error)
 }
 
 // LocationCheckRepository интерфейс для сохранения проверок местоположения.
 type LocationCheckRepository interface {
-	CreateLocationCheck(ctx context.Context, check *entity.LocationCheck) error
-	RecordIncidentMatch(ctx context.Context, checkID, incidentID int) error
+	// SaveLocationCheck сохраняет проверку, совпавшие зоны и сообщения outbox в одной транзакции.
+	SaveLocationCheck(ctx context.Context, check *entity.LocationCheck, incidentIDs []int, outbox []*entity.OutboxMessage) error
+	// SaveLocationChecks сохраняет пакет проверок (matches[i] — зоны checks[i]) и сообщения outbox в одной транзакции.
+	SaveLocationChecks(ctx context.Context, checks []*entity.LocationCheck, matches [][]int, outbox []*entity.OutboxMessage) error
+	// GetLocationChecks возвращает журнал проверок (новые первыми) с совпавшими зонами.
+	GetLocationChecks(ctx context.Context, filter entity.CheckFilter) ([]*entity.LocationCheck, error)
+}
+
+// LastLocationRepository последние известные местоположения пользователей.
+type LastLocationRepository interface {
+	// FindLastLocations возвращает пользователей, последнее местоположение которых получено не раньше since
+	// и попадает в прямоугольник area. Точное попадание в зону проверяет вызывающий.
+	FindLastLocations(ctx context.Context, area entity.BBox, since time.Time) ([]*entity.LocationCheck, error)
+}
+
+// LastLocationStore хранилище последних местоположений пользователей с поиском по расстоянию (Redis GEO).
+// Местоположения старше TTL хранилища не возвращаются и со временем удаляются.
+type LastLocationStore interface {
+	LastLocationRepository
+	// SaveLastLocations запоминает местоположения из проверок; более старые, чем уже сохраненные, пропускаются.
+	SaveLastLocations(ctx context.Context, checks []*entity.LocationCheck) error
+	// FindUsersWithin возвращает пользователей не дальше meters от точки, ближайших первыми.
+	FindUsersWithin(ctx context.Context, lat, lon, meters float64) ([]*entity.UserLocation, error)
+}
+
+// OutboxRepository интерфейс для ретрансляции сообщений outbox в очередь (PostgreSQL).
+type OutboxRepository interface {
+	// PublishOutbox блокирует до limit неотправленных сообщений, передает их в publish и помечает отправленными
+	// те, что удалось опубликовать. Возвращает количество отправленных сообщений.
+	PublishOutbox(ctx context.Context, limit int, publish func(*entity.OutboxMessage) error) (int, error)
+	// PurgeOutbox удаляет отправленные сообщения старше before.
+	PurgeOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxWriter интерфейс записи сообщений outbox, не связанных с проверкой местоположения (PostgreSQL).
+type OutboxWriter interface {
+	// SaveOutbox сохраняет сообщения одной транзакцией: все или ни одного.
+	SaveOutbox(ctx context.Context, messages []*entity.OutboxMessage) error
+}
+
+// SubscriptionRepository интерфейс для хранения подписок на вебхуки (PostgreSQL).
+type SubscriptionRepository interface {
+	CreateSubscription(ctx context.Context, s *entity.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error)
+	GetSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error)
+	GetActiveSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, s *entity.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id int) error
+	RotateSubscriptionSecret(ctx context.Context, id int, secret string, grace time.Duration, revokePrevious bool) (*entity.WebhookSubscription, error)
+}
+
+// DeliveryLogRepository интерфейс журнала доставки вебхуков (PostgreSQL).
+type DeliveryLogRepository interface {
+	RecordDelivery(ctx context.Context, d *entity.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, f entity.DeliveryFilter) ([]*entity.WebhookDelivery, error)
+	// GetFailedDeliveries возвращает последние попытки доставок, неудачных в интервале и так и не доставленных.
+	GetFailedDeliveries(ctx context.Context, from, to time.Time, subscriptionID *int, limit int) ([]*entity.WebhookDelivery, error)
+}
+
+// GeofenceStateRepository хранит, в каких зонах сейчас находится пользователь (Redis).
+type GeofenceStateRepository interface {
+	GetMemberships(ctx context.Context, userID string) (map[int]*entity.ZoneMembership, error)
+	SetMemberships(ctx context.Context, userID string, memberships map[int]*entity.ZoneMembership) error
 }
 
 // QueueRepository интерфейс для работы с очередью задач (Redis).
+// Доставка «хотя бы один раз»: полученная задача остается за воркером до подтверждения,
+// а неподтвержденные дольше таймаута видимости задачи забираются повторно (Reclaim).
 type QueueRepository interface {
 	Enqueue(ctx context.Context, task string, payload interface{}) error
-	Dequeue(ctx context.Context, task string) (string, error) // Возвращает JSON полезной нагрузки
+	Dequeue(ctx context.Context, task string) (*entity.QueueTask, error) // nil, если задач не появилось за время ожидания
+	Ack(ctx context.Context, task string, taskID string) error
+	Reclaim(ctx context.Context, task string, minIdle time.Duration, count int) ([]*entity.QueueTask, error)
+	// Retry подтверждает задачу и откладывает ее новую версию (payload) до момента at.
+	Retry(ctx context.Context, task string, t *entity.QueueTask, payload interface{}, at time.Time) error
+	PromoteDue(ctx context.Context, task string, limit int) (int, error) // Возвращает в очередь наступившие отложенные задачи
+	DeadLetter(ctx context.Context, task string, t *entity.QueueTask, reason string) error
+	ListDeadLetters(ctx context.Context, limit int) ([]*entity.DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, id string) error // Возвращает задачу в исходную очередь
 }
 
 // IncidentCache интерфейс для кеширования инцидентов (Redis).
 type IncidentCache interface {
-	SetIncidents(ctx context.Context, incidents []*entity.Incident) error
+	// SetIncidents сохраняет список, только если версия кеша не изменилась с момента IncidentsVersion
+	// (иначе список мог устареть из-за конкурентного изменения инцидентов).
+	SetIncidents(ctx context.Context, incidents []*entity.Incident, version int64) error
 	GetIncidents(ctx context.Context) ([]*entity.Incident, error)
+	// IncidentsVersion возвращает версию кеша, которая увеличивается при каждой инвалидации.
+	IncidentsVersion(ctx context.Context) (int64, error)
+	// InvalidateIncidents сбрасывает кеш и оповещает все экземпляры сервиса об изменении инцидентов.
+	InvalidateIncidents(ctx context.Context) error
+	// SubscribeInvalidations возвращает канал уведомлений об изменении инцидентов (закрывается при отмене контекста).
+	SubscribeInvalidations(ctx context.Context) (<-chan struct{}, error)
 }
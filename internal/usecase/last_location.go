@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// ErrLastLocationsDisabled хранилище последних местоположений не настроено.
+var ErrLastLocationsDisabled = errors.New("last location store is not configured")
+
+// saveLastLocations обновляет последние местоположения пользователей.
+// Ошибка только логируется: проверки уже сохранены, а местоположение обновится при следующей.
+func (s *GeoService) saveLastLocations(ctx context.Context, checks []*entity.LocationCheck) {
+	if s.LastLocations == nil {
+		return
+	}
+	if err := s.LastLocations.SaveLastLocations(ctx, checks); err != nil {
+		log.Printf("Failed to save last locations: %v", err)
+	}
+}
+
+// UsersNear возвращает пользователей, последнее местоположение которых не дальше meters от точки (ближайших первыми).
+func (s *GeoService) UsersNear(ctx context.Context, lat, lon, meters float64) ([]*entity.UserLocation, error) {
+	if s.LastLocations == nil {
+		return nil, ErrLastLocationsDisabled
+	}
+	return s.LastLocations.FindUsersWithin(ctx, lat, lon, meters)
+}
+
+// UsersNearIncident возвращает пользователей внутри зоны инцидента или не дальше meters от ее границы.
+// DistanceMeters — расстояние до границы зоны (0 — внутри), ближайшие первыми.
+func (s *GeoService) UsersNearIncident(ctx context.Context, incidentID int, meters float64) ([]*entity.UserLocation, error) {
+	if s.LastLocations == nil {
+		return nil, ErrLastLocationsDisabled
+	}
+	incident, err := s.IncidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Кандидаты — в круге вокруг центра зоны, покрывающем всю зону вместе с буфером
+	reach := float64(incident.RadiusMeters)
+	if incident.Geometry != nil {
+		for _, p := range incident.Geometry.Polygons {
+			if len(p) == 0 {
+				continue
+			}
+			for _, pos := range p[0] {
+				reach = max(reach, distanceMeters(incident.Latitude, incident.Longitude, pos.Lat(), pos.Lon()))
+			}
+		}
+	}
+	// Запас в 1% покрывает расхождение формул расстояния в хранилище и в distanceMeters
+	candidates, err := s.LastLocations.FindUsersWithin(ctx, incident.Latitude, incident.Longitude, (reach+meters)*1.01)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*entity.UserLocation, 0, len(candidates))
+	for _, u := range candidates {
+		u.DistanceMeters = 0
+		if !incidentContains(incident, u.Latitude, u.Longitude) {
+			d, _ := distanceToEdge(incident, u.Latitude, u.Longitude)
+			if d > meters {
+				continue
+			}
+			u.DistanceMeters = d
+		}
+		users = append(users, u)
+	}
+	slices.SortStableFunc(users, func(a, b *entity.UserLocation) int {
+		return cmp.Compare(a.DistanceMeters, b.DistanceMeters)
+	})
+	return users, nil
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// ProximityWarning зона, к границе которой пользователь находится ближе буфера предупреждения.
+type ProximityWarning struct {
+	Incident       *entity.Incident `json:"incident"`
+	DistanceMeters float64          `json:"distance_meters"` // расстояние до границы зоны
+	BearingDegrees float64          `json:"bearing_degrees"` // азимут на ближайшую точку границы (0° — север)
+}
+
+// findNearby возвращает зоны, в которые попадает точка, и зоны, до границы которых не больше bufferMeters.
+// Предупреждения отсортированы по расстоянию. При холодном кеше индекс строится синхронно,
+// так как поиск в БД (FindContaining) находит только зоны, содержащие точку.
+func (s *GeoService) findNearby(ctx context.Context, lat, lon, bufferMeters float64) ([]*entity.Incident, []*ProximityWarning, error) {
+	idx, err := s.snapshotIndex(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var matches []*entity.Incident
+	var warnings []*ProximityWarning
+	for _, i := range idx.queryBBox(aroundBBox(lat, lon, bufferMeters)) {
+		if !incidentActiveAt(i, now) {
+			continue
+		}
+		if incidentContains(i, lat, lon) {
+			matches = append(matches, i)
+			continue
+		}
+		if d, bearing := distanceToEdge(i, lat, lon); d <= bufferMeters {
+			warnings = append(warnings, &ProximityWarning{Incident: i, DistanceMeters: d, BearingDegrees: bearing})
+		}
+	}
+	slices.SortStableFunc(warnings, func(a, b *ProximityWarning) int {
+		return cmp.Compare(a.DistanceMeters, b.DistanceMeters)
+	})
+	return matches, warnings, nil
+}
+
+const (
+	// nearestInitialRadius радиус первого шага поиска ближайших зон; радиус растет, пока не найдено нужное количество.
+	nearestInitialRadius = 1000.0
+	// maxEarthDistance наибольшее расстояние между точками на поверхности Земли (половина окружности).
+	maxEarthDistance = math.Pi * 6371000
+)
+
+// NearbyIncident зона и расстояние до нее от заданной точки.
+type NearbyIncident struct {
+	Incident       *entity.Incident `json:"incident"`
+	DistanceMeters float64          `json:"distance_meters"` // расстояние до границы зоны (0 — точка внутри зоны)
+}
+
+// NearestIncidents возвращает ближайшие к точке активные зоны в порядке расстояния: не более limit зон (0 — без ограничения)
+// и не дальше maxDistance метров (0 — на любом расстоянии). Поиск идет по локальному индексу с расширяющимся радиусом.
+func (s *GeoService) NearestIncidents(ctx context.Context, lat, lon float64, limit int, maxDistance float64) ([]*NearbyIncident, error) {
+	idx, err := s.snapshotIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if maxDistance <= 0 || maxDistance > maxEarthDistance {
+		maxDistance = maxEarthDistance
+	}
+
+	radius := maxDistance
+	if limit > 0 {
+		radius = min(nearestInitialRadius, maxDistance)
+	}
+	now := time.Now()
+	for {
+		var res []*NearbyIncident
+		for _, i := range idx.queryBBox(aroundBBox(lat, lon, radius)) {
+			if !incidentActiveAt(i, now) {
+				continue
+			}
+			d := 0.0
+			if !incidentContains(i, lat, lon) {
+				d, _ = distanceToEdge(i, lat, lon)
+			}
+			if d <= radius {
+				res = append(res, &NearbyIncident{Incident: i, DistanceMeters: d})
+			}
+		}
+
+		// Зоны дальше текущего радиуса могли не попасть в выборку, поэтому результат полон,
+		// только если найдено limit зон или радиус достиг предела
+		if (limit > 0 && len(res) >= limit) || radius >= maxDistance {
+			slices.SortStableFunc(res, func(a, b *NearbyIncident) int {
+				return cmp.Compare(a.DistanceMeters, b.DistanceMeters)
+			})
+			if limit > 0 && len(res) > limit {
+				res = res[:limit]
+			}
+			return res, nil
+		}
+		radius = min(radius*4, maxDistance)
+	}
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"maps"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// notifyUsersInside оповещает пользователей, последнее известное местоположение которых
+// (не старше LastLocationMaxAge) попадает в зону after, но не попадало в зону before (nil для нового инцидента).
+// Так о новой или расширенной зоне узнают сразу, а не при следующей проверке местоположения.
+// Без геофенсинга отправляется danger_zone_detected, с геофенсингом — zone_entered с записью входа в состояние.
+// События записываются в outbox одной вставкой. Ошибки только логируются: изменение инцидента уже сохранено.
+func (s *IncidentService) notifyUsersInside(ctx context.Context, before, after *entity.Incident) {
+	if s.LastLocations == nil || s.Outbox == nil || s.LastLocationMaxAge <= 0 {
+		return
+	}
+	now := time.Now()
+	if !incidentActiveAt(after, now) {
+		return
+	}
+	if before != nil && !incidentActiveAt(before, now) {
+		before = nil // до изменения зона не действовала, и о ней никого не оповещали
+	}
+
+	locations, err := s.LastLocations.FindLastLocations(ctx, toEntityBBox(incidentBBox(after)), now.Add(-s.LastLocationMaxAge))
+	if err != nil {
+		log.Printf("Failed to find users inside incident %d: %v", after.ID, err)
+		return
+	}
+
+	var events []entity.WebhookEvent
+	states := make(map[string]map[int]*entity.ZoneMembership) // новое состояние геофенсинга по пользователям
+	for _, l := range locations {
+		if !incidentContains(after, l.Latitude, l.Longitude) {
+			continue
+		}
+		if before != nil && incidentContains(before, l.Latitude, l.Longitude) {
+			continue // был в зоне и до изменения
+		}
+		if s.Geofence == nil {
+			events = append(events, newZoneEvent(entity.EventDangerZoneDetected, l.UserID, after, now))
+			continue
+		}
+
+		prev, err := s.Geofence.GetMemberships(ctx, l.UserID)
+		if err != nil {
+			// Как и при проверке местоположения: лучше повторно уведомить, чем потерять событие
+			log.Printf("Failed to load geofence state for user %s, falling back to danger_zone_detected: %v", l.UserID, err)
+			events = append(events, newZoneEvent(entity.EventDangerZoneDetected, l.UserID, after, now))
+			continue
+		}
+		if m, ok := prev[after.ID]; ok && !m.Approaching {
+			continue // вход уже зафиксирован проверкой местоположения
+		}
+		next := maps.Clone(prev)
+		if next == nil {
+			next = make(map[int]*entity.ZoneMembership, 1)
+		}
+		next[after.ID] = &entity.ZoneMembership{EnteredAt: now}
+		states[l.UserID] = next
+		events = append(events, newZoneEvent(entity.EventZoneEntered, l.UserID, after, now))
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	outbox, err := outboxMessages(s.QueueName, events)
+	if err == nil {
+		err = s.Outbox.SaveOutbox(ctx, outbox)
+	}
+	if err != nil {
+		log.Printf("Failed to save notifications for %d users inside incident %d: %v", len(events), after.ID, err)
+		return
+	}
+	// Состояние сохраняется после записи событий: если записать его не удалось, следующая проверка
+	// повторит zone_entered — дубль лучше потерянного события
+	for userID, next := range states {
+		if err := s.Geofence.SetMemberships(ctx, userID, next); err != nil {
+			log.Printf("Failed to save geofence state for user %s: %v", userID, err)
+		}
+	}
+}
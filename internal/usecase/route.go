@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// RouteSegment участок маршрута внутри зоны: от точки входа до точки выхода.
+// Если маршрут начинается или заканчивается внутри зоны, точкой входа (выхода) считается его начало (конец).
+type RouteSegment struct {
+	Entry        entity.Position `json:"entry"` // [lon, lat], как в GeoJSON
+	Exit         entity.Position `json:"exit"`
+	LengthMeters float64         `json:"length_meters"`
+}
+
+// RouteIntersection зона, которую пересекает маршрут, и участки маршрута внутри нее.
+type RouteIntersection struct {
+	Incident     *entity.Incident `json:"incident"`
+	Segments     []RouteSegment   `json:"segments"`
+	LengthMeters float64          `json:"length_meters"` // суммарная длина маршрута внутри зоны
+}
+
+// CheckRoute находит активные зоны, которые пересекает маршрут (ломаная из точек [lon, lat]),
+// с точками входа и выхода и длиной маршрута внутри каждой зоны.
+// Используется тот же локальный набор инцидентов, что и при проверке точек.
+func (s *GeoService) CheckRoute(ctx context.Context, route []entity.Position) ([]*RouteIntersection, error) {
+	idx, err := s.snapshotIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	routeBox := bbox{minLat: math.Inf(1), minLon: math.Inf(1), maxLat: math.Inf(-1), maxLon: math.Inf(-1)}
+	for _, p := range route {
+		routeBox.minLat, routeBox.maxLat = math.Min(routeBox.minLat, p.Lat()), math.Max(routeBox.maxLat, p.Lat())
+		routeBox.minLon, routeBox.maxLon = math.Min(routeBox.minLon, p.Lon()), math.Max(routeBox.maxLon, p.Lon())
+	}
+
+	now := time.Now()
+	var res []*RouteIntersection
+	for _, incident := range idx.queryBBox(routeBox) {
+		if !incidentActiveAt(incident, now) {
+			continue
+		}
+		if segments := routeSegments(incident, route); len(segments) > 0 {
+			ri := &RouteIntersection{Incident: incident, Segments: segments}
+			for _, seg := range segments {
+				ri.LengthMeters += seg.LengthMeters
+			}
+			res = append(res, ri)
+		}
+	}
+	return res, nil
+}
+
+// routeSegments разбивает каждое звено маршрута точками пересечения с границей зоны
+// и собирает участки, середина которых лежит внутри зоны, в непрерывные отрезки.
+// Звенья считаются прямыми в координатах lon/lat, что достаточно точно для звеньев до нескольких километров.
+func routeSegments(incident *entity.Incident, route []entity.Position) []RouteSegment {
+	box := incidentBBox(incident)
+	var segments []RouteSegment
+	var open *RouteSegment // текущий участок внутри зоны
+
+	closeOpen := func() {
+		if open != nil {
+			segments = append(segments, *open)
+			open = nil
+		}
+	}
+
+	if len(route) == 1 {
+		if incidentContains(incident, route[0].Lat(), route[0].Lon()) {
+			segments = append(segments, RouteSegment{Entry: route[0], Exit: route[0]})
+		}
+		return segments
+	}
+
+	for k := 0; k+1 < len(route); k++ {
+		a, b := route[k], route[k+1]
+		legBox := bbox{
+			minLat: math.Min(a.Lat(), b.Lat()), maxLat: math.Max(a.Lat(), b.Lat()),
+			minLon: math.Min(a.Lon(), b.Lon()), maxLon: math.Max(a.Lon(), b.Lon()),
+		}
+		// Прямоугольник зоны, выходящий за антимеридиан, не годится для отсечения звеньев
+		if !legBox.intersects(box) && box.minLon >= -180 && box.maxLon <= 180 {
+			closeOpen()
+			continue
+		}
+
+		ts := append([]float64{0, 1}, boundaryCrossings(incident, a, b)...)
+		slices.Sort(ts)
+		ts = slices.Compact(ts)
+
+		for n := 0; n+1 < len(ts); n++ {
+			t0, t1 := ts[n], ts[n+1]
+			if t1-t0 < 1e-12 {
+				continue
+			}
+			mid := interpolate(a, b, (t0+t1)/2)
+			if !incidentContains(incident, mid.Lat(), mid.Lon()) {
+				closeOpen()
+				continue
+			}
+			p0, p1 := interpolate(a, b, t0), interpolate(a, b, t1)
+			if open == nil {
+				open = &RouteSegment{Entry: p0}
+			}
+			open.Exit = p1
+			open.LengthMeters += distanceMeters(p0.Lat(), p0.Lon(), p1.Lat(), p1.Lon())
+		}
+	}
+	closeOpen()
+	return segments
+}
+
+// interpolate возвращает точку звена a→b с параметром t ∈ [0, 1].
+func interpolate(a, b entity.Position, t float64) entity.Position {
+	return entity.Position{a.Lon() + (b.Lon()-a.Lon())*t, a.Lat() + (b.Lat()-a.Lat())*t}
+}
+
+// boundaryCrossings возвращает параметры t ∈ (0, 1), в которых звено a→b пересекает границу зоны.
+func boundaryCrossings(incident *entity.Incident, a, b entity.Position) []float64 {
+	if incident.Geometry != nil {
+		var ts []float64
+		for _, p := range incident.Geometry.Polygons {
+			for _, ring := range p {
+				for n := 0; n+1 < len(ring); n++ {
+					if t, ok := segmentIntersection(a, b, ring[n], ring[n+1]); ok {
+						ts = append(ts, t)
+					}
+				}
+			}
+		}
+		return ts
+	}
+	return circleCrossings(incident, a, b)
+}
+
+// segmentIntersection находит пересечение отрезков a→b и c→d на плоскости lon/lat.
+// Возвращает параметр точки пересечения на a→b.
+func segmentIntersection(a, b, c, d entity.Position) (float64, bool) {
+	rx, ry := b.Lon()-a.Lon(), b.Lat()-a.Lat()
+	sx, sy := d.Lon()-c.Lon(), d.Lat()-c.Lat()
+	denom := rx*sy - ry*sx
+	if denom == 0 {
+		return 0, false // параллельные отрезки: границу определит проверка середин соседних участков
+	}
+	qx, qy := c.Lon()-a.Lon(), c.Lat()-a.Lat()
+	t := (qx*sy - qy*sx) / denom
+	u := (qx*ry - qy*rx) / denom
+	if t <= 0 || t >= 1 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
+}
+
+// circleCrossings находит пересечения звена с окружностью зоны в локальной проекции (метры вокруг центра).
+func circleCrossings(incident *entity.Incident, a, b entity.Position) []float64 {
+	cosLat := math.Cos(incident.Latitude * math.Pi / 180)
+	project := func(p entity.Position) (float64, float64) {
+		return (p.Lon() - incident.Longitude) * metersPerDegree * cosLat, (p.Lat() - incident.Latitude) * metersPerDegree
+	}
+	ax, ay := project(a)
+	bx, by := project(b)
+	dx, dy := bx-ax, by-ay
+	r := float64(incident.RadiusMeters)
+
+	// |A + t·D|² = r²  →  (D·D)t² + 2(A·D)t + (A·A − r²) = 0
+	qa := dx*dx + dy*dy
+	qb := 2 * (ax*dx + ay*dy)
+	qc := ax*ax + ay*ay - r*r
+	disc := qb*qb - 4*qa*qc
+	if qa == 0 || disc < 0 {
+		return nil
+	}
+	sq := math.Sqrt(disc)
+	var ts []float64
+	for _, t := range []float64{(-qb - sq) / (2 * qa), (-qb + sq) / (2 * qa)} {
+		if t > 0 && t < 1 {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+func TestRouteSegments(t *testing.T) {
+	circle := &entity.Incident{ID: 1, Latitude: 55.75, Longitude: 37.6, RadiusMeters: 1000}
+	// Квадрат 0.1°×0.1° с дырой 0.02°×0.02° посередине
+	square := &entity.Incident{ID: 2, Geometry: &entity.Geometry{Type: entity.GeometryPolygon, Polygons: []entity.Polygon{{
+		{{20, 20}, {20.1, 20}, {20.1, 20.1}, {20, 20.1}, {20, 20}},
+		{{20.04, 20.04}, {20.06, 20.04}, {20.06, 20.06}, {20.04, 20.06}, {20.04, 20.04}},
+	}}}}
+
+	tests := []struct {
+		name     string
+		incident *entity.Incident
+		route    []entity.Position
+		want     [][2]float64 // долготы точек входа и выхода
+	}{
+		{
+			name:     "circle crossed through the center",
+			incident: circle,
+			route:    []entity.Position{{37.5, 55.75}, {37.7, 55.75}},
+			want:     [][2]float64{{37.6 - 1000/(metersPerDegree*math.Cos(55.75*math.Pi/180)), 37.6 + 1000/(metersPerDegree*math.Cos(55.75*math.Pi/180))}},
+		},
+		{
+			name:     "route starts inside and turns inside",
+			incident: circle,
+			route:    []entity.Position{{37.6, 55.75}, {37.601, 55.75}, {37.7, 55.75}},
+			want:     [][2]float64{{37.6, 37.6 + 1000/(metersPerDegree*math.Cos(55.75*math.Pi/180))}},
+		},
+		{
+			name:     "route misses the zone",
+			incident: circle,
+			route:    []entity.Position{{37.5, 55.8}, {37.7, 55.8}},
+		},
+		{
+			name:     "polygon with hole is entered twice",
+			incident: square,
+			route:    []entity.Position{{19.9, 20.05}, {20.2, 20.05}},
+			want:     [][2]float64{{20, 20.04}, {20.06, 20.1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := routeSegments(tt.incident, tt.route)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d segments, got %+v", len(tt.want), got)
+			}
+			for n, seg := range got {
+				if math.Abs(seg.Entry.Lon()-tt.want[n][0]) > 1e-5 || math.Abs(seg.Exit.Lon()-tt.want[n][1]) > 1e-5 {
+					t.Errorf("Segment %d: expected lon %v, got entry %v exit %v", n, tt.want[n], seg.Entry, seg.Exit)
+				}
+				wantLen := distanceMeters(seg.Entry.Lat(), seg.Entry.Lon(), seg.Exit.Lat(), seg.Exit.Lon())
+				if math.Abs(seg.LengthMeters-wantLen) > 1 {
+					t.Errorf("Segment %d: expected length %.1f, got %.1f", n, wantLen, seg.LengthMeters)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package usecase
+
+import (
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+const (
+	// metersPerDegree длина одного градуса дуги большого круга (для радиуса Земли из distanceMeters).
+	metersPerDegree = 2 * math.Pi * 6371000 / 360
+
+	// defaultCellSizeDeg размер ячейки сетки индекса в градусах (~1.1 км по широте).
+	defaultCellSizeDeg = 0.01
+
+	// maxCellsPerIncident ограничивает число ячеек на одну зону: очень большие зоны
+	// (и зоны, пересекающие антимеридиан или полюса) проверяются для каждого запроса отдельно.
+	maxCellsPerIncident = 4096
+)
+
+// bbox охватывающий прямоугольник в градусах.
+type bbox struct {
+	minLat, minLon, maxLat, maxLon float64
+}
+
+// contains проверяет попадание точки в прямоугольник.
+func (b bbox) contains(lat, lon float64) bool {
+	return lat >= b.minLat && lat <= b.maxLat && lon >= b.minLon && lon <= b.maxLon
+}
+
+// intersects проверяет пересечение двух прямоугольников.
+func (b bbox) intersects(o bbox) bool {
+	return b.minLat <= o.maxLat && b.maxLat >= o.minLat && b.minLon <= o.maxLon && b.maxLon >= o.minLon
+}
+
+// incidentBBox вычисляет охватывающий прямоугольник зоны инцидента.
+// Для окружности прямоугольник берется с небольшим запасом, чтобы гарантированно покрыть зону.
+func incidentBBox(i *entity.Incident) bbox {
+	if i.Geometry != nil {
+		b := bbox{minLat: math.Inf(1), minLon: math.Inf(1), maxLat: math.Inf(-1), maxLon: math.Inf(-1)}
+		for _, p := range i.Geometry.Polygons {
+			if len(p) == 0 {
+				continue
+			}
+			for _, pos := range p[0] {
+				b.minLat, b.maxLat = math.Min(b.minLat, pos.Lat()), math.Max(b.maxLat, pos.Lat())
+				b.minLon, b.maxLon = math.Min(b.minLon, pos.Lon()), math.Max(b.maxLon, pos.Lon())
+			}
+		}
+		return b
+	}
+
+	return aroundBBox(i.Latitude, i.Longitude, float64(i.RadiusMeters))
+}
+
+// aroundBBox вычисляет прямоугольник, гарантированно покрывающий окружность радиусом meters вокруг точки.
+func aroundBBox(lat, lon, meters float64) bbox {
+	dLat := meters / metersPerDegree * 1.01
+	dLon := 360.0
+	if cos := math.Cos(math.Min(math.Abs(lat)+dLat, 90) * math.Pi / 180); cos > 1e-9 {
+		dLon = math.Min(dLat/cos, 360)
+	}
+	return bbox{minLat: lat - dLat, maxLat: lat + dLat, minLon: lon - dLon, maxLon: lon + dLon}
+}
+
+// split нормализует прямоугольник: долгота за пределами ±180 переносится через антимеридиан, и тогда прямоугольник
+// делится на две части по обе стороны от него; широта ограничивается полюсами.
+func (b bbox) split() []bbox {
+	b.minLat, b.maxLat = max(b.minLat, -90), min(b.maxLat, 90)
+	switch {
+	case b.maxLon-b.minLon >= 360:
+		b.minLon, b.maxLon = -180, 180
+	case b.minLon < -180:
+		west := b
+		b.minLon, west.minLon, west.maxLon = -180, b.minLon+360, 180
+		return []bbox{b, west}
+	case b.maxLon > 180:
+		east := b
+		b.maxLon, east.minLon, east.maxLon = 180, -180, b.maxLon-360
+		return []bbox{b, east}
+	}
+	return []bbox{b}
+}
+
+// toEntityBBox переводит прямоугольник в entity.BBox: долгота за пределами ±180 переносится через антимеридиан
+// (тогда MinLon > MaxLon), широта ограничивается полюсами.
+func toEntityBBox(b bbox) entity.BBox {
+	out := entity.BBox{MinLat: max(b.minLat, -90), MinLon: b.minLon, MaxLat: min(b.maxLat, 90), MaxLon: b.maxLon}
+	switch {
+	case b.maxLon-b.minLon >= 360:
+		out.MinLon, out.MaxLon = -180, 180
+	case b.minLon < -180:
+		out.MinLon += 360
+	case b.maxLon > 180:
+		out.MaxLon -= 360
+	}
+	return out
+}
+
+// cellKey координаты ячейки сетки.
+type cellKey struct {
+	x, y int32
+}
+
+// spatialIndex неизменяемый сеточный индекс зон инцидентов.
+// Каждая зона регистрируется во всех ячейках, которые пересекает ее охватывающий прямоугольник,
+// поэтому запрос по точке затрагивает только зоны из одной ячейки.
+type spatialIndex struct {
+	cellSize  float64
+	incidents []*entity.Incident
+	boxes     []bbox
+	cells     map[cellKey][]int32
+	large     []int32 // зоны, которые проверяются при каждом запросе
+}
+
+// newSpatialIndex строит индекс по набору инцидентов.
+func newSpatialIndex(incidents []*entity.Incident, cellSize float64) *spatialIndex {
+	idx := &spatialIndex{
+		cellSize:  cellSize,
+		incidents: incidents,
+		boxes:     make([]bbox, len(incidents)),
+		cells:     make(map[cellKey][]int32),
+	}
+
+	for n, i := range incidents {
+		b := incidentBBox(i)
+		idx.boxes[n] = b
+
+		if math.IsInf(b.minLat, 1) {
+			continue // пустая геометрия никогда не совпадет
+		}
+		if b.minLon < -180 || b.maxLon > 180 {
+			idx.large = append(idx.large, int32(n))
+			continue
+		}
+
+		x0, y0 := idx.cell(b.minLat, b.minLon)
+		x1, y1 := idx.cell(b.maxLat, b.maxLon)
+		if int64(x1-x0+1)*int64(y1-y0+1) > maxCellsPerIncident {
+			idx.large = append(idx.large, int32(n))
+			continue
+		}
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				k := cellKey{x, y}
+				idx.cells[k] = append(idx.cells[k], int32(n))
+			}
+		}
+	}
+	return idx
+}
+
+// cell возвращает координаты ячейки, содержащей точку.
+func (idx *spatialIndex) cell(lat, lon float64) (int32, int32) {
+	return int32(math.Floor(lon / idx.cellSize)), int32(math.Floor(lat / idx.cellSize))
+}
+
+// query возвращает зоны, в которые попадает точка.
+func (idx *spatialIndex) query(lat, lon float64) []*entity.Incident {
+	var matches []*entity.Incident
+
+	x, y := idx.cell(lat, lon)
+	for _, n := range idx.cells[cellKey{x, y}] {
+		if idx.boxes[n].contains(lat, lon) && incidentContains(idx.incidents[n], lat, lon) {
+			matches = append(matches, idx.incidents[n])
+		}
+	}
+	// Для больших зон прямоугольник может «переходить» через антимеридиан, поэтому проверяем точно
+	for _, n := range idx.large {
+		if incidentContains(idx.incidents[n], lat, lon) {
+			matches = append(matches, idx.incidents[n])
+		}
+	}
+	return matches
+}
+
+// queryBBox возвращает зоны, охватывающий прямоугольник которых пересекает b (кандидаты без точной проверки),
+// в порядке добавления в индекс. Прямоугольник, пересекающий антимеридиан, проверяется по обе стороны от него.
+func (idx *spatialIndex) queryBBox(b bbox) []*entity.Incident {
+	seen := make(map[int32]bool)
+	for _, part := range b.split() {
+		x0, y0 := idx.cell(part.minLat, part.minLon)
+		x1, y1 := idx.cell(part.maxLat, part.maxLon)
+
+		if int64(x1-x0+1)*int64(y1-y0+1) > int64(len(idx.incidents)) {
+			// Прямоугольник покрывает больше ячеек, чем зон в индексе: быстрее проверить все зоны
+			for n, box := range idx.boxes {
+				if box.intersects(part) {
+					seen[int32(n)] = true
+				}
+			}
+			continue
+		}
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				for _, n := range idx.cells[cellKey{x, y}] {
+					if idx.boxes[n].intersects(part) {
+						seen[n] = true
+					}
+				}
+			}
+		}
+	}
+	for _, n := range idx.large {
+		seen[n] = true
+	}
+
+	ids := slices.Sorted(maps.Keys(seen))
+	res := make([]*entity.Incident, len(ids))
+	for k, n := range ids {
+		res[k] = idx.incidents[n]
+	}
+	return res
+}
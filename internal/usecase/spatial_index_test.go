@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// randomIncidents генерирует набор окружностей и полигонов в окрестностях Москвы.
+func randomIncidents(rng *rand.Rand, n int) []*entity.Incident {
+	incidents := make([]*entity.Incident, 0, n)
+	for id := 1; id <= n; id++ {
+		lat := 55.0 + rng.Float64()*1.5
+		lon := 36.5 + rng.Float64()*2.5
+		i := &entity.Incident{ID: id, Latitude: lat, Longitude: lon, RadiusMeters: 50 + rng.Intn(2000)}
+		if id%10 == 0 {
+			d := 0.002 + rng.Float64()*0.01
+			i.Geometry = &entity.Geometry{Type: entity.GeometryPolygon, Polygons: []entity.Polygon{{{
+				{lon - d, lat - d}, {lon + d, lat - d}, {lon, lat + d}, {lon - d, lat - d},
+			}}}}
+			i.RadiusMeters = 0
+		}
+		incidents = append(incidents, i)
+	}
+	return incidents
+}
+
+// linearScan исходный алгоритм: проверка каждой зоны.
+func linearScan(incidents []*entity.Incident, lat, lon float64) []*entity.Incident {
+	var matches []*entity.Incident
+	for _, i := range incidents {
+		if incidentContains(i, lat, lon) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func TestSpatialIndex_MatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	incidents := randomIncidents(rng, 5000)
+	// Зона, покрывающая слишком много ячеек, и зона у антимеридиана
+	incidents = append(incidents,
+		&entity.Incident{ID: 100001, Latitude: 55.5, Longitude: 37.5, RadiusMeters: 200000},
+		&entity.Incident{ID: 100002, Latitude: 0, Longitude: 179.999, RadiusMeters: 5000},
+	)
+	idx := newSpatialIndex(incidents, defaultCellSizeDeg)
+
+	points := [][2]float64{{0, -179.999}, {0, 179.99}}
+	for range 5000 {
+		points = append(points, [2]float64{55.0 + rng.Float64()*1.5, 36.5 + rng.Float64()*2.5})
+	}
+
+	for _, p := range points {
+		want := map[int]bool{}
+		for _, i := range linearScan(incidents, p[0], p[1]) {
+			want[i.ID] = true
+		}
+		got := idx.query(p[0], p[1])
+		if len(got) != len(want) {
+			t.Fatalf("Point %v: expected %d matches, got %d", p, len(want), len(got))
+		}
+		for _, i := range got {
+			if !want[i.ID] {
+				t.Fatalf("Point %v: unexpected match %d", p, i.ID)
+			}
+		}
+	}
+}
+
+func TestToEntityBBox(t *testing.T) {
+	tests := []struct {
+		in   bbox
+		want entity.BBox
+	}{
+		{bbox{minLat: 10, minLon: 20, maxLat: 11, maxLon: 21}, entity.BBox{MinLat: 10, MinLon: 20, MaxLat: 11, MaxLon: 21}},
+		// Через антимеридиан: MinLon > MaxLon
+		{bbox{minLat: 10, minLon: 179, maxLat: 11, maxLon: 181}, entity.BBox{MinLat: 10, MinLon: 179, MaxLat: 11, MaxLon: -179}},
+		{bbox{minLat: 10, minLon: -181, maxLat: 11, maxLon: -179}, entity.BBox{MinLat: 10, MinLon: 179, MaxLat: 11, MaxLon: -179}},
+		// У полюса окружность охватывает все долготы
+		{bbox{minLat: 89, minLon: -340, maxLat: 91, maxLon: 380}, entity.BBox{MinLat: 89, MinLon: -180, MaxLat: 90, MaxLon: 180}},
+	}
+	for _, tt := range tests {
+		if got := toEntityBBox(tt.in); got != tt.want {
+			t.Errorf("toEntityBBox(%+v) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSpatialIndex_QueryBBoxAcrossAntimeridian(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// Зоны по обе стороны от антимеридиана, в индексе достаточно зон, чтобы поиск шел по ячейкам
+	incidents := append(randomIncidents(rng, 500),
+		&entity.Incident{ID: 100001, Latitude: 0, Longitude: 179.99, RadiusMeters: 100},
+		&entity.Incident{ID: 100002, Latitude: 0, Longitude: -179.99, RadiusMeters: 100},
+	)
+	idx := newSpatialIndex(incidents, defaultCellSizeDeg)
+
+	tests := []struct {
+		lon  float64
+		want int
+	}{
+		{-179.999, 100001}, // прямоугольник уходит за -180
+		{179.999, 100002},  // прямоугольник уходит за 180
+	}
+	for _, tt := range tests {
+		found := false
+		for _, i := range idx.queryBBox(aroundBBox(0, tt.lon, 5000)) {
+			found = found || i.ID == tt.want
+		}
+		if !found {
+			t.Errorf("queryBBox around (0, %v): expected zone %d across the antimeridian", tt.lon, tt.want)
+		}
+	}
+}
+
+func benchmarkPoints(rng *rand.Rand) [][2]float64 {
+	points := make([][2]float64, 1024)
+	for n := range points {
+		points[n] = [2]float64{55.0 + rng.Float64()*1.5, 36.5 + rng.Float64()*2.5}
+	}
+	return points
+}
+
+func BenchmarkCheck_LinearScan(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	incidents := randomIncidents(rng, 20000)
+	points := benchmarkPoints(rng)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		p := points[n%len(points)]
+		linearScan(incidents, p[0], p[1])
+	}
+}
+
+func BenchmarkCheck_SpatialIndex(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	idx := newSpatialIndex(randomIncidents(rng, 20000), defaultCellSizeDeg)
+	points := benchmarkPoints(rng)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		p := points[n%len(points)]
+		idx.query(p[0], p[1])
+	}
+}
+
+func BenchmarkSpatialIndex_Build(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	incidents := randomIncidents(rng, 20000)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		newSpatialIndex(incidents, defaultCellSizeDeg)
+	}
+}
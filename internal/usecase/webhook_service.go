@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+	"github.com/paincake00/geocore/internal/webhooksig"
+)
+
+// ErrInvalidEvent событие в очереди не удалось разобрать: повторная обработка не поможет.
+var ErrInvalidEvent = errors.New("invalid event payload")
+
+// WebhookService отвечает за доставку вебхуков: подписки, рассылку событий подписчикам
+// и очередь недоставленных задач.
+type WebhookService struct {
+	Queue             QueueRepository
+	Subscriptions     SubscriptionRepository
+	DeliveryQueueName string
+	// DefaultURL подписчик по умолчанию, получающий все события (пусто — отключен).
+	DefaultURL string
+	// DefaultSecrets секреты подписи для подписчика по умолчанию: первый — текущий, остальные — предыдущие.
+	DefaultSecrets []string
+	// Deliveries журнал попыток доставки (если не задан, попытки не сохраняются).
+	Deliveries DeliveryLogRepository
+	// SecretGracePeriod сколько после ротации доставки еще подписываются прежним секретом подписки.
+	SecretGracePeriod time.Duration
+}
+
+// maxResendBatch сколько доставок за раз можно повторно отправить за период.
+const maxResendBatch = 1000
+
+// NewWebhookService создает новый экземпляр сервиса вебхуков.
+func NewWebhookService(q QueueRepository, subs SubscriptionRepository, defaultURL string) *WebhookService {
+	return &WebhookService{
+		Queue:             q,
+		Subscriptions:     subs,
+		DeliveryQueueName: "webhook_deliveries", // очередь доставок, которую обрабатывает воркер
+		DefaultURL:        defaultURL,
+		SecretGracePeriod: 24 * time.Hour,
+	}
+}
+
+// subscriptionMatches проверяет, подходит ли событие под фильтры подписки.
+func subscriptionMatches(s *entity.WebhookSubscription, e *entity.WebhookEvent) bool {
+	if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, e.Event) {
+		return false
+	}
+	if len(s.IncidentIDs) > 0 && !slices.Contains(s.IncidentIDs, e.IncidentID) {
+		return false
+	}
+	// События без категории и уровня опасности (например, выход из удаленной зоны) фильтры по ним не отсекают
+	if len(s.Categories) > 0 && e.IncidentCategory != "" && !slices.Contains(s.Categories, e.IncidentCategory) {
+		return false
+	}
+	if s.MinSeverity != "" && e.IncidentSeverity != "" && entity.SeverityRank(e.IncidentSeverity) < entity.SeverityRank(s.MinSeverity) {
+		return false
+	}
+	return true
+}
+
+// FanOut ставит в очередь доставки событие для каждого подходящего подписчика.
+// Возвращает количество созданных доставок.
+func (s *WebhookService) FanOut(ctx context.Context, payload string) (int, error) {
+	var event entity.WebhookEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	subs, err := s.Subscriptions.GetActiveSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var targets []int
+	if s.DefaultURL != "" {
+		targets = append(targets, 0)
+	}
+	for _, sub := range subs {
+		if subscriptionMatches(sub, &event) {
+			targets = append(targets, sub.ID)
+		}
+	}
+
+	now := time.Now()
+	for _, id := range targets {
+		deliveryID, err := newDeliveryID()
+		if err != nil {
+			return 0, err
+		}
+		task := entity.DeliveryTask{DeliveryID: deliveryID, SubscriptionID: id, Event: json.RawMessage(payload), CreatedAt: now}
+		if err := s.Queue.Enqueue(ctx, s.DeliveryQueueName, task); err != nil {
+			return 0, err
+		}
+	}
+	return len(targets), nil
+}
+
+// newDeliveryID генерирует идентификатор доставки.
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ResolveSubscription возвращает подписчика доставки: подписку из БД или подписчика по умолчанию (ID 0).
+func (s *WebhookService) ResolveSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error) {
+	if id == 0 {
+		if s.DefaultURL == "" {
+			return nil, fmt.Errorf("default webhook subscriber is disabled")
+		}
+		sub := &entity.WebhookSubscription{URL: s.DefaultURL, Active: true}
+		if len(s.DefaultSecrets) > 0 {
+			sub.Secret = s.DefaultSecrets[0]
+			// Предыдущие секреты из конфигурации действуют, пока их не уберут из WEBHOOK_SECRETS
+			for _, secret := range s.DefaultSecrets[1:] {
+				sub.PreviousSecrets = append(sub.PreviousSecrets, entity.PreviousSecret{Secret: secret})
+			}
+		}
+		return sub, nil
+	}
+	return s.Subscriptions.GetSubscription(ctx, id)
+}
+
+// CreateSubscription создает подписку. Если секрет не задан, он генерируется.
+func (s *WebhookService) CreateSubscription(ctx context.Context, sub *entity.WebhookSubscription) error {
+	if sub.Secret == "" {
+		secret, err := webhooksig.NewSecret()
+		if err != nil {
+			return err
+		}
+		sub.Secret = secret
+	}
+	return s.Subscriptions.CreateSubscription(ctx, sub)
+}
+
+// GetSubscription возвращает подписку по ID.
+func (s *WebhookService) GetSubscription(ctx context.Context, id int) (*entity.WebhookSubscription, error) {
+	return s.Subscriptions.GetSubscription(ctx, id)
+}
+
+// GetSubscriptions возвращает все подписки.
+func (s *WebhookService) GetSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	return s.Subscriptions.GetSubscriptions(ctx)
+}
+
+// UpdateSubscription обновляет подписку.
+func (s *WebhookService) UpdateSubscription(ctx context.Context, sub *entity.WebhookSubscription) error {
+	return s.Subscriptions.UpdateSubscription(ctx, sub)
+}
+
+// DeleteSubscription удаляет подписку.
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id int) error {
+	return s.Subscriptions.DeleteSubscription(ctx, id)
+}
+
+// RotateSecret заменяет секрет подписки (пустой secret — сгенерировать новый).
+// Старый секрет остается активным SecretGracePeriod или пока его не отзовут (revokePrevious),
+// чтобы получатель успел перейти на новый.
+func (s *WebhookService) RotateSecret(ctx context.Context, id int, secret string, revokePrevious bool) (*entity.WebhookSubscription, error) {
+	if secret == "" {
+		var err error
+		if secret, err = webhooksig.NewSecret(); err != nil {
+			return nil, err
+		}
+	}
+	return s.Subscriptions.RotateSubscriptionSecret(ctx, id, secret, s.SecretGracePeriod, revokePrevious)
+}
+
+// RecordDelivery сохраняет попытку доставки в журнал. attempt — номер попытки, начиная с 1.
+func (s *WebhookService) RecordDelivery(ctx context.Context, task *entity.DeliveryTask, sub *entity.WebhookSubscription, attempt, status int, latency time.Duration, sendErr error) error {
+	if s.Deliveries == nil {
+		return nil
+	}
+
+	// Из события берем поля для фильтрации журнала; некорректное событие все равно записываем
+	var event entity.WebhookEvent
+	_ = json.Unmarshal(task.Event, &event)
+
+	d := &entity.WebhookDelivery{
+		DeliveryID:     task.DeliveryID,
+		SubscriptionID: task.SubscriptionID,
+		URL:            sub.URL,
+		Event:          event.Event,
+		IncidentID:     event.IncidentID,
+		UserID:         event.UserID,
+		Attempt:        attempt,
+		RequestBody:    task.Event,
+		ResponseStatus: status,
+		LatencyMs:      latency.Milliseconds(),
+		Status:         entity.DeliveryStatusSucceeded,
+	}
+	if sendErr != nil {
+		d.Status = entity.DeliveryStatusFailed
+		d.Error = sendErr.Error()
+	}
+	return s.Deliveries.RecordDelivery(ctx, d)
+}
+
+// deliveryLog возвращает журнал доставок или ошибку, если он не настроен.
+func (s *WebhookService) deliveryLog() (DeliveryLogRepository, error) {
+	if s.Deliveries == nil {
+		return nil, errors.New("delivery log is disabled")
+	}
+	return s.Deliveries, nil
+}
+
+// GetDeliveries возвращает страницу журнала доставок по фильтру (новые первыми).
+func (s *WebhookService) GetDeliveries(ctx context.Context, f entity.DeliveryFilter) (entity.Page[*entity.WebhookDelivery], error) {
+	repo, err := s.deliveryLog()
+	if err != nil {
+		return entity.Page[*entity.WebhookDelivery]{}, err
+	}
+
+	limit := f.Limit
+	f.Limit = limit + 1 // лишняя запись показывает, есть ли следующая страница
+	deliveries, err := repo.GetDeliveries(ctx, f)
+	if err != nil {
+		return entity.Page[*entity.WebhookDelivery]{}, err
+	}
+	return entity.NewPage(deliveries, limit, func(d *entity.WebhookDelivery) entity.Cursor {
+		return entity.Cursor{Time: d.CreatedAt, ID: d.ID}
+	}), nil
+}
+
+// GetDelivery возвращает запись журнала доставок по ID.
+func (s *WebhookService) GetDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error) {
+	repo, err := s.deliveryLog()
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetDelivery(ctx, id)
+}
+
+// ResendDelivery повторно ставит в очередь событие из записи журнала тому же подписчику.
+// Новая доставка продолжает ту же (DeliveryID), но со свежим счетчиком попыток.
+func (s *WebhookService) ResendDelivery(ctx context.Context, id int64) error {
+	d, err := s.GetDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.resend(ctx, d)
+}
+
+// ResendFailed повторно отправляет доставки, неудачные в интервале [from, to) и так и не доставленные.
+// Возвращает количество поставленных в очередь доставок.
+func (s *WebhookService) ResendFailed(ctx context.Context, from, to time.Time, subscriptionID *int) (int, error) {
+	repo, err := s.deliveryLog()
+	if err != nil {
+		return 0, err
+	}
+	failed, err := repo.GetFailedDeliveries(ctx, from, to, subscriptionID, maxResendBatch)
+	if err != nil {
+		return 0, err
+	}
+	for n, d := range failed {
+		if err := s.resend(ctx, d); err != nil {
+			return n, err
+		}
+	}
+	return len(failed), nil
+}
+
+// resend ставит в очередь новую доставку события из журнала.
+func (s *WebhookService) resend(ctx context.Context, d *entity.WebhookDelivery) error {
+	task := entity.DeliveryTask{
+		DeliveryID:     d.DeliveryID,
+		SubscriptionID: d.SubscriptionID,
+		Event:          d.RequestBody,
+		CreatedAt:      time.Now(),
+	}
+	return s.Queue.Enqueue(ctx, s.DeliveryQueueName, task)
+}
+
+// ListDeadLetters возвращает последние недоставленные задачи.
+func (s *WebhookService) ListDeadLetters(ctx context.Context, limit int) ([]*entity.DeadLetter, error) {
+	return s.Queue.ListDeadLetters(ctx, limit)
+}
+
+// ReplayDeadLetter возвращает недоставленную задачу в очередь для повторной доставки.
+func (s *WebhookService) ReplayDeadLetter(ctx context.Context, id string) error {
+	return s.Queue.ReplayDeadLetter(ctx, id)
+}
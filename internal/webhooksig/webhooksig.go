@@ -0,0 +1,102 @@
+// Package webhooksig реализует подпись исходящих вебхуков и ее проверку на стороне получателя.
+//
+// Подпись — HMAC-SHA256 от строки "<timestamp>.<body>", где timestamp — Unix-время в секундах
+// из заголовка X-Geocore-Timestamp. Заголовок X-Geocore-Signature содержит по одной подписи
+// "v1=<hex>" на каждый активный секрет через запятую, поэтому при ротации секрета получатель,
+// знающий любой из них, принимает запрос.
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Geocore-Signature"
+	TimestampHeader = "X-Geocore-Timestamp"
+
+	// scheme версия схемы подписи в заголовке.
+	scheme = "v1"
+
+	// DefaultTolerance допустимое расхождение времени подписи и проверки (защита от повтора запросов).
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	ErrTimestampExpired = errors.New("timestamp outside tolerance")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Compute вычисляет подпись тела запроса одним секретом.
+func Compute(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign возвращает значения заголовков X-Geocore-Timestamp и X-Geocore-Signature для всех секретов.
+// Пустые секреты пропускаются; если секретов нет, подпись пустая.
+func Sign(secrets []string, ts time.Time, body []byte) (timestamp, signature string) {
+	unix := ts.Unix()
+	var parts []string
+	for _, s := range secrets {
+		if s != "" {
+			parts = append(parts, scheme+"="+Compute(s, unix, body))
+		}
+	}
+	return strconv.FormatInt(unix, 10), strings.Join(parts, ",")
+}
+
+// Verify проверяет, что запрос подписан хотя бы одним из секретов и подпись не старше tolerance.
+func Verify(secrets []string, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	if signature == "" || timestamp == "" {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrTimestampExpired
+	}
+
+	for _, part := range strings.Split(signature, ",") {
+		v, sig, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || v != scheme {
+			continue
+		}
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		for _, s := range secrets {
+			if s == "" {
+				continue
+			}
+			want, _ := hex.DecodeString(Compute(s, unix, body))
+			if hmac.Equal(got, want) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// NewSecret генерирует случайный секрет для подписки.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,41 @@
+package webhooksig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"zone_entered","incident_id":1}`)
+	now := time.Unix(1700000000, 0)
+
+	// Ротация: подписываем старым и новым секретом
+	ts, sig := Sign([]string{"new", "old"}, now, body)
+
+	tests := []struct {
+		name    string
+		secrets []string
+		ts      string
+		sig     string
+		body    []byte
+		at      time.Time
+		want    error
+	}{
+		{"current secret", []string{"new"}, ts, sig, body, now, nil},
+		{"previous secret", []string{"old"}, ts, sig, body, now, nil},
+		{"wrong secret", []string{"other"}, ts, sig, body, now, ErrInvalidSignature},
+		{"tampered body", []string{"new"}, ts, sig, []byte(`{"event":"zone_exited"}`), now, ErrInvalidSignature},
+		{"stale timestamp", []string{"new"}, ts, sig, body, now.Add(10 * time.Minute), ErrTimestampExpired},
+		{"missing signature", []string{"new"}, ts, "", body, now, ErrMissingSignature},
+		{"bad timestamp", []string{"new"}, "abc", sig, body, now, ErrInvalidTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secrets, tt.ts, tt.sig, tt.body, DefaultTolerance, tt.at)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
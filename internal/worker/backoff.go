@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backoff вычисляет задержку перед повторной попыткой: экспоненциальный рост от base с потолком max
+// и случайным разбросом (половина задержки фиксирована, половина случайна), чтобы повторы
+// многих доставок одному получателю не приходили одновременно.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// maxRetryAfter наибольшая задержка, которую принимаем из Retry-After. Большие значения ограничиваются,
+// чтобы не переполнить time.Duration; доставка с такой задержкой все равно превысит срок и уйдет в недоставленные.
+const maxRetryAfter = 365 * 24 * time.Hour
+
+// parseRetryAfter разбирает заголовок Retry-After: число секунд или HTTP-дата (не больше maxRetryAfter).
+// Возвращает 0, если заголовок отсутствует или некорректен.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	// При выходе за диапазон int64 ParseInt возвращает ошибку ErrRange и предельное значение со знаком числа
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		switch {
+		case secs < 0:
+			return 0
+		case secs > int64(maxRetryAfter/time.Second):
+			return maxRetryAfter
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return min(t.Sub(now), maxRetryAfter)
+	}
+	return 0
+}
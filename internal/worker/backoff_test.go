@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base, max := time.Second, time.Minute
+
+	tests := []struct {
+		attempt int
+		full    time.Duration // задержка без разброса
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute}, // 64s упирается в потолок
+		{50, time.Minute},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			d := backoff(tt.attempt, base, max)
+			if d < tt.full/2 || d > tt.full {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", tt.attempt, d, tt.full/2, tt.full)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+		{"31536000000", maxRetryAfter},          // 1000 лет: time.Duration(secs) * time.Second переполнился бы
+		{"99999999999999999999", maxRetryAfter}, // за пределами int64
+		{"-99999999999999999999", 0},
+		{now.Add(50 * 365 * 24 * time.Hour).Format(http.TimeFormat), maxRetryAfter},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		d, want time.Duration
+	}{
+		{0, time.Second},
+		{-time.Minute, time.Second},
+		{500 * time.Millisecond, time.Second},
+		{time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := atLeast(tt.d, time.Second); got != tt.want {
+			t.Errorf("atLeast(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/paincake00/geocore/internal/usecase"
+)
+
+// ExpiryJob периодически завершает истекшие инциденты (статус resolved + событие incident_resolved).
+type ExpiryJob struct {
+	Service  *usecase.IncidentService
+	Interval time.Duration
+}
+
+// NewExpiryJob создает новую фоновую задачу завершения инцидентов.
+func NewExpiryJob(s *usecase.IncidentService, interval time.Duration) *ExpiryJob {
+	return &ExpiryJob{Service: s, Interval: interval}
+}
+
+// Start запускает периодическую проверку до отмены контекста.
+func (j *ExpiryJob) Start(ctx context.Context) {
+	log.Println("Starting incident expiry job...")
+	j.Interval = atLeast(j.Interval, time.Second)
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Incident expiry job stopped")
+			return
+		case <-ticker.C:
+			n, err := j.Service.ResolveExpired(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Failed to resolve expired incidents: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Resolved %d expired incidents", n)
+			}
+		}
+	}
+}
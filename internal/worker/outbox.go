@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+	"github.com/paincake00/geocore/internal/usecase"
+)
+
+// OutboxRelay публикует в очередь сообщения outbox, сохраненные в PostgreSQL вместе с проверками местоположения,
+// и помечает их отправленными. Сообщение может быть опубликовано повторно (если отметка не сохранилась),
+// но не будет потеряно.
+type OutboxRelay struct {
+	Repo      usecase.OutboxRepository
+	Queue     usecase.QueueRepository
+	Interval  time.Duration
+	BatchSize int
+	// Retention сколько хранятся отправленные сообщения перед удалением.
+	Retention time.Duration
+}
+
+// NewOutboxRelay создает новый ретранслятор outbox.
+func NewOutboxRelay(repo usecase.OutboxRepository, q usecase.QueueRepository, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		Repo:      repo,
+		Queue:     q,
+		Interval:  interval,
+		BatchSize: 100,
+		Retention: 24 * time.Hour,
+	}
+}
+
+// Start запускает ретрансляцию до отмены контекста.
+func (r *OutboxRelay) Start(ctx context.Context) {
+	log.Println("Starting outbox relay...")
+	r.Interval = atLeast(r.Interval, 10*time.Millisecond)
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-purge.C:
+			if n, err := r.Repo.PurgeOutbox(ctx, time.Now().Add(-r.Retention)); err != nil {
+				log.Printf("Failed to purge outbox: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d sent outbox messages", n)
+			}
+		case <-ticker.C:
+			r.relay(ctx)
+		}
+	}
+}
+
+// relay публикует все накопившиеся сообщения пачками по BatchSize.
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for {
+		n, err := r.Repo.PublishOutbox(ctx, r.BatchSize, func(m *entity.OutboxMessage) error {
+			return r.Queue.Enqueue(ctx, m.Queue, m.Payload)
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to relay outbox (%d published): %v", n, err)
+			}
+			return
+		}
+		if n < r.BatchSize {
+			return
+		}
+	}
+}
@@ -3,97 +3,427 @@ package worker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/paincake00/geocore/internal/entity"
 	"github.com/paincake00/geocore/internal/usecase"
+	"github.com/paincake00/geocore/internal/webhooksig"
 )
 
-// Worker отвечает за фоновую обработку задач (отправку вебхуков).
+// Worker отвечает за фоновую обработку задач: рассылку событий подписчикам и отправку вебхуков.
+// Задача подтверждается в очереди только после успешной обработки или перемещения в очередь недоставленных,
+// поэтому при падении воркера ее заберет другой экземпляр по истечении VisibilityTimeout.
 type Worker struct {
-	Queue      usecase.QueueRepository
-	QueueName  string
-	WebhookURL string
-	MaxRetries int
+	Queue             usecase.QueueRepository
+	Webhooks          *usecase.WebhookService
+	QueueName         string // очередь событий
+	DeliveryQueueName string // очередь доставок конкретным подписчикам
+	VisibilityTimeout time.Duration
+	// Повторные попытки доставки (подписка может переопределить MaxAttempts и MaxAge).
+	MaxAttempts int
+	MaxAge      time.Duration
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Concurrency максимальное количество одновременно обрабатываемых задач.
+	Concurrency int
+
+	slots    chan struct{}  // семафор пула обработчиков
+	pulling  sync.WaitGroup // циклы, забирающие задачи из очередей
+	inflight sync.WaitGroup // задачи в обработке
+	mu       sync.Mutex
+	running  map[string]runningTask
+}
+
+// runningTask задача в обработке (для возврата в очередь при завершении).
+type runningTask struct {
+	queue  string
+	task   *entity.QueueTask
+	cancel context.CancelFunc // отменяет обработку, если задача возвращена в очередь
+}
+
+// minVisibilityTimeout наименьший таймаут видимости задачи.
+const minVisibilityTimeout = 2 * time.Second
+
+// atLeast возвращает d, но не меньше min: нулевой или отрицательный интервал из настроек
+// вызвал бы панику time.NewTicker.
+func atLeast(d, min time.Duration) time.Duration {
+	if d < min {
+		log.Printf("Interval %v is too small, using %v", d, min)
+		return min
+	}
+	return d
 }
 
 // New создает новый экземпляр воркера.
-func New(q usecase.QueueRepository, webhookURL string) *Worker {
+func New(q usecase.QueueRepository, ws *usecase.WebhookService) *Worker {
 	return &Worker{
-		Queue:      q,
-		QueueName:  "webhook_tasks", // та же очередь, что и в сервисе
-		WebhookURL: webhookURL,
-		MaxRetries: 3,
+		Queue:             q,
+		Webhooks:          ws,
+		QueueName:         "webhook_tasks", // та же очередь, что и в сервисе
+		DeliveryQueueName: ws.DeliveryQueueName,
+		VisibilityTimeout: time.Minute,
+		MaxAttempts:       8,
+		MaxAge:            24 * time.Hour,
+		BackoffBase:       5 * time.Second,
+		BackoffMax:        time.Hour,
+		Concurrency:       10,
+		running:           make(map[string]runningTask),
 	}
 }
 
-// Start запускает цикл обработки задач.
+// Start запускает обработку очередей событий и доставок. Блокируется до отмены контекста.
+// После отмены новые задачи не забираются; дождаться уже начатых позволяет Shutdown.
 func (w *Worker) Start(ctx context.Context) {
-	log.Println("Starting background worker...")
+	if w.Concurrency < 1 {
+		w.Concurrency = 1
+	}
+	// reclaimLoop проверяет зависшие задачи раз в VisibilityTimeout/2; нулевой тикер вызвал бы панику
+	w.VisibilityTimeout = atLeast(w.VisibilityTimeout, minVisibilityTimeout)
+	log.Printf("Starting background worker (concurrency %d)...", w.Concurrency)
+	w.slots = make(chan struct{}, w.Concurrency)
+
+	loops := []func(){
+		func() { w.consume(ctx, w.QueueName, w.processEvent) },
+		func() { w.consume(ctx, w.DeliveryQueueName, w.processDelivery) },
+		func() { w.reclaimLoop(ctx, w.QueueName, w.processEvent) },
+		func() { w.reclaimLoop(ctx, w.DeliveryQueueName, w.processDelivery) },
+		func() { w.scheduleLoop(ctx, w.QueueName) },
+		func() { w.scheduleLoop(ctx, w.DeliveryQueueName) },
+	}
+	w.pulling.Add(len(loops))
+	for _, loop := range loops {
+		go func() {
+			defer w.pulling.Done()
+			loop()
+		}()
+	}
+	w.pulling.Wait()
+	log.Println("Worker stopped pulling tasks")
+}
+
+// Shutdown ожидает завершения начатых задач после остановки Start (отмены его контекста).
+// Если ctx истекает раньше, незавершенные задачи возвращаются в очередь, чтобы их сразу забрал другой экземпляр,
+// не дожидаясь VisibilityTimeout. Обработка возвращенных задач отменяется, а их подтверждение или повтор
+// пропускаются (см. claim), поэтому задача не доставляется дважды.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.pulling.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Worker drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Контекст завершения уже истек — для возврата задач используем отдельный
+	requeueCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, r := range w.running {
+		r.cancel()
+		delete(w.running, id) // обработчик больше не может подтвердить задачу
+		if err := w.Queue.Retry(requeueCtx, r.queue, r.task, json.RawMessage(r.task.Payload), time.Now()); err != nil {
+			log.Printf("Failed to requeue task %s: %v", r.task.ID, err)
+			continue
+		}
+		log.Printf("Requeued unfinished task %s to %s", r.task.ID, r.queue)
+	}
+	return ctx.Err()
+}
+
+// acquire занимает слот пула обработчиков. Возвращает false, если контекст отменен.
+func (w *Worker) acquire(ctx context.Context) bool {
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// run обрабатывает задачу в занятом слоте пула и освобождает его по завершении.
+// Контекст обработки отменяется, если Shutdown вернул задачу в очередь.
+func (w *Worker) run(queueName string, task *entity.QueueTask, process func(context.Context, *entity.QueueTask)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.mu.Lock()
+	w.running[task.ID] = runningTask{queue: queueName, task: task, cancel: cancel}
+	w.mu.Unlock()
+	w.inflight.Add(1)
+
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			delete(w.running, task.ID)
+			w.mu.Unlock()
+			cancel()
+			<-w.slots
+			w.inflight.Done()
+		}()
+		process(ctx, task)
+	}()
+}
+
+// claim забирает у Shutdown право вернуть задачу в очередь перед ее подтверждением, повтором или переносом
+// в недоставленные. Возвращает false, если Shutdown уже вернул задачу: тогда обработчик не должен ее трогать.
+func (w *Worker) claim(task *entity.QueueTask) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.running[task.ID]; !ok {
+		log.Printf("Task %s was requeued on shutdown, skipping", task.ID)
+		return false
+	}
+	delete(w.running, task.ID)
+	return true
+}
+
+// consume читает задачи из очереди и обрабатывает их в пуле.
+// Новая задача забирается из очереди только при наличии свободного слота, поэтому при заполненном пуле
+// задачи остаются в Redis и достаются другим экземплярам.
+func (w *Worker) consume(ctx context.Context, queueName string, process func(context.Context, *entity.QueueTask)) {
 	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Worker stopped")
+		if !w.acquire(ctx) {
 			return
-		default:
-			// Получаем задачу
-			// Логика Dequeue в RedisRepo блокирует выполнение (timeout 0 = бесконечно).
-			// Если контекст отменен, клиент Redis вернет ошибку.
-			payloadJSON, err := w.Queue.Dequeue(ctx, w.QueueName)
+		}
+
+		// Dequeue ожидает новую задачу ограниченное время и возвращает nil, если задач нет.
+		task, err := w.Queue.Dequeue(ctx, queueName)
+		if err != nil || task == nil {
+			<-w.slots
 			if err != nil {
 				// Если ошибка из-за отмены контекста, выходим
 				if ctx.Err() != nil {
 					return
 				}
-				log.Printf("Worker dequeue error: %v", err)
+				log.Printf("Worker dequeue error (%s): %v", queueName, err)
 				time.Sleep(1 * time.Second) // пауза при ошибке
-				continue
 			}
+			continue
+		}
 
-			// Обрабатываем асинхронно
-			go w.processTask(payloadJSON)
+		w.run(queueName, task, process)
+	}
+}
+
+// reclaimLoop периодически забирает задачи, которые были получены, но не подтверждены дольше VisibilityTimeout
+// (например, воркер упал во время доставки), и обрабатывает их повторно. Забирается не больше задач, чем свободно слотов.
+func (w *Worker) reclaimLoop(ctx context.Context, queueName string, process func(context.Context, *entity.QueueTask)) {
+	ticker := time.NewTicker(w.VisibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			free := cap(w.slots) - len(w.slots)
+			if free == 0 {
+				continue
+			}
+			tasks, err := w.Queue.Reclaim(ctx, queueName, w.VisibilityTimeout, free)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Worker reclaim error (%s): %v", queueName, err)
+				}
+				continue
+			}
+			for _, task := range tasks {
+				// Если пул успел заполниться, оставшиеся задачи дождутся следующего reclaim
+				if !w.acquire(ctx) {
+					return
+				}
+				log.Printf("Reclaimed stuck task %s from %s", task.ID, queueName)
+				w.run(queueName, task, process)
+			}
 		}
 	}
 }
 
-// processTask обрабатывает одну задачу (отправку вебхука) с повторными попытками.
-func (w *Worker) processTask(data string) {
-	// Отправка на мок-сервер с ретраями
-	log.Printf("Processing task: %s", data)
+// processEvent рассылает событие всем подходящим подписчикам (по отдельной задаче доставки на каждого).
+func (w *Worker) processEvent(ctx context.Context, task *entity.QueueTask) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	n, err := w.Webhooks.FanOut(ctx, task.Payload)
+	if errors.Is(err, usecase.ErrInvalidEvent) {
+		w.deadLetterFrom(ctx, w.QueueName, task, err.Error())
+		return
+	}
+	if err != nil {
+		// Задача останется неподтвержденной и будет обработана повторно после VisibilityTimeout
+		log.Printf("Failed to fan out event %s: %v", task.ID, err)
+		return
+	}
+	log.Printf("Event %s fanned out to %d subscribers", task.ID, n)
+
+	w.ack(ctx, w.QueueName, task)
+}
+
+// processDelivery выполняет одну попытку доставки события подписчику.
+// При ошибке следующая попытка откладывается в Redis (см. QueueRepository.Retry), поэтому состояние повторов
+// переживает перезапуск воркера и не занимает горутину на время ожидания.
+func (w *Worker) processDelivery(ctx context.Context, task *entity.QueueTask) {
+	log.Printf("Processing delivery %s: %s", task.ID, task.Payload)
+
+	// ctx не зависит от отмены основного цикла (отменяется, только если задачу вернул Shutdown);
+	// запас на HTTP-запрос и запись журнала
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var delivery entity.DeliveryTask
+	if err := json.Unmarshal([]byte(task.Payload), &delivery); err != nil {
+		w.deadLetter(ctx, task, fmt.Sprintf("invalid delivery task: %v", err))
+		return
+	}
+
+	sub, err := w.Webhooks.ResolveSubscription(ctx, delivery.SubscriptionID)
+	if err != nil || !sub.Active {
+		// Подписку удалили или отключили после рассылки — доставлять некому
+		log.Printf("Dropping delivery %s: subscription %d is unavailable", task.ID, delivery.SubscriptionID)
+		w.ack(ctx, w.DeliveryQueueName, task)
+		return
+	}
+
+	started := time.Now()
+	status, retryAfter, err := w.sendWebhook(ctx, sub, delivery.Event)
+	if logErr := w.Webhooks.RecordDelivery(ctx, &delivery, sub, delivery.Attempt+1, status, time.Since(started), err); logErr != nil {
+		log.Printf("Failed to record delivery %s: %v", task.ID, logErr)
+	}
+	if err == nil {
+		log.Printf("Webhook sent successfully to subscription %d", delivery.SubscriptionID)
+		w.ack(ctx, w.DeliveryQueueName, task)
+		return
+	}
+
+	delivery.Attempt++
+	maxAttempts, maxAge := w.limits(sub)
+	log.Printf("Failed to send webhook to subscription %d (attempt %d/%d): %v", delivery.SubscriptionID, delivery.Attempt, maxAttempts, err)
+
+	// Получатель сам указал, когда повторить (Retry-After), иначе — экспоненциальная задержка
+	delay := retryAfter
+	if delay == 0 {
+		delay = backoff(delivery.Attempt, w.BackoffBase, w.BackoffMax)
+	}
+	next := time.Now().Add(delay)
+
+	// Задержка больше срока доставки превысит его при любом времени создания (в том числе неизвестном)
+	if delivery.Attempt >= maxAttempts || delay > maxAge || (!delivery.CreatedAt.IsZero() && next.Sub(delivery.CreatedAt) > maxAge) {
+		log.Printf("Given up on delivery %s, moving to dead-letter queue", task.ID)
+		w.deadLetter(ctx, task, err.Error())
+		return
+	}
+
+	if !w.claim(task) {
+		return
+	}
+	if err := w.Queue.Retry(ctx, w.DeliveryQueueName, task, delivery, next); err != nil {
+		// Задача останется неподтвержденной и будет забрана повторно после VisibilityTimeout
+		log.Printf("Failed to schedule retry for delivery %s: %v", task.ID, err)
+	}
+}
+
+// limits возвращает ограничения повторных попыток для подписки (настройки воркера, если у подписки не заданы).
+func (w *Worker) limits(sub *entity.WebhookSubscription) (int, time.Duration) {
+	maxAttempts, maxAge := w.MaxAttempts, w.MaxAge
+	if sub.MaxAttempts > 0 {
+		maxAttempts = sub.MaxAttempts
+	}
+	if sub.MaxAgeSeconds > 0 {
+		maxAge = time.Duration(sub.MaxAgeSeconds) * time.Second
+	}
+	return maxAttempts, maxAge
+}
 
-	// Здесь можно добавить валидацию JSON, но пока просто пересылаем.
+// scheduleLoop периодически возвращает в очередь доставки, время повторной попытки которых наступило.
+func (w *Worker) scheduleLoop(ctx context.Context, queueName string) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-	for i := 0; i < w.MaxRetries; i++ {
-		err := w.sendWebhook(data)
-		if err == nil {
-			log.Printf("Webhook sent successfully")
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			for {
+				n, err := w.Queue.PromoteDue(ctx, queueName, 100)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Worker schedule error (%s): %v", queueName, err)
+					}
+					break
+				}
+				if n < 100 {
+					break
+				}
+			}
 		}
-		log.Printf("Failed to send webhook (attempt %d/%d): %v", i+1, w.MaxRetries, err)
-		time.Sleep(time.Duration(2*i+1) * time.Second) // Линейная задержка: 1s, 3s, 5s...
 	}
-	log.Printf("Given up on task: %s", data)
 }
 
-// sendWebhook выполняет HTTP POST запрос на мок-сервер.
-func (w *Worker) sendWebhook(data string) error {
-	req, err := http.NewRequest("POST", w.WebhookURL, bytes.NewBufferString(data))
+// ack подтверждает задачу в очереди.
+func (w *Worker) ack(ctx context.Context, queueName string, task *entity.QueueTask) {
+	if !w.claim(task) {
+		return
+	}
+	if err := w.Queue.Ack(ctx, queueName, task.ID); err != nil {
+		log.Printf("Failed to ack task %s: %v", task.ID, err)
+	}
+}
+
+// deadLetter перемещает доставку в очередь недоставленных.
+func (w *Worker) deadLetter(ctx context.Context, task *entity.QueueTask, reason string) {
+	w.deadLetterFrom(ctx, w.DeliveryQueueName, task, reason)
+}
+
+// deadLetterFrom перемещает задачу указанной очереди в очередь недоставленных.
+func (w *Worker) deadLetterFrom(ctx context.Context, queueName string, task *entity.QueueTask, reason string) {
+	if !w.claim(task) {
+		return
+	}
+	if err := w.Queue.DeadLetter(ctx, queueName, task, reason); err != nil {
+		log.Printf("Failed to dead-letter task %s: %v", task.ID, err)
+	}
+}
+
+// sendWebhook выполняет HTTP POST запрос на адрес подписчика и возвращает статус ответа (0 — ответ не получен).
+// Запрос подписывается всеми действующими секретами подписки (см. пакет webhooksig).
+// При ошибке возвращает задержку из заголовка Retry-After, если получатель ее указал.
+func (w *Worker) sendWebhook(ctx context.Context, sub *entity.WebhookSubscription, data []byte) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.URL, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	now := time.Now()
+	ts, signature := webhooksig.Sign(sub.SigningSecrets(now), now, data)
+	req.Header.Set(webhooksig.TimestampHeader, ts)
+	if signature != "" {
+		req.Header.Set(webhooksig.SignatureHeader, signature)
+	}
+
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+		return resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), fmt.Errorf("server returned status: %d", resp.StatusCode)
 	}
-	return nil
+	return resp.StatusCode, 0, nil
 }
@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paincake00/geocore/internal/entity"
+)
+
+// fakeQueue отдает заранее подготовленные задачи и запоминает возвращенные в очередь.
+type fakeQueue struct {
+	mu       sync.Mutex
+	tasks    []*entity.QueueTask
+	requeued []string
+	acked    []string
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, queue string, payload interface{}) error { return nil }
+func (q *fakeQueue) Dequeue(ctx context.Context, queue string) (*entity.QueueTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return nil, nil
+		}
+	}
+	t := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return t, nil
+}
+func (q *fakeQueue) Ack(ctx context.Context, queue, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, id)
+	return nil
+}
+func (q *fakeQueue) Reclaim(ctx context.Context, queue string, minIdle time.Duration, count int) ([]*entity.QueueTask, error) {
+	return nil, nil
+}
+func (q *fakeQueue) Retry(ctx context.Context, queue string, t *entity.QueueTask, payload interface{}, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := payload.(json.RawMessage); !ok {
+		panic("requeued payload must be raw JSON")
+	}
+	q.requeued = append(q.requeued, t.ID)
+	return nil
+}
+func (q *fakeQueue) PromoteDue(ctx context.Context, queue string, limit int) (int, error) {
+	return 0, nil
+}
+func (q *fakeQueue) DeadLetter(ctx context.Context, queue string, t *entity.QueueTask, reason string) error {
+	return nil
+}
+func (q *fakeQueue) ListDeadLetters(ctx context.Context, limit int) ([]*entity.DeadLetter, error) {
+	return nil, nil
+}
+func (q *fakeQueue) ReplayDeadLetter(ctx context.Context, id string) error { return nil }
+
+func TestWorker_BoundedPoolAndShutdown(t *testing.T) {
+	queue := &fakeQueue{}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		queue.tasks = append(queue.tasks, &entity.QueueTask{ID: id, Payload: `{}`})
+	}
+
+	w := &Worker{Queue: queue, VisibilityTimeout: time.Minute, Concurrency: 2, running: make(map[string]runningTask)}
+	w.slots = make(chan struct{}, w.Concurrency)
+
+	var active, peak atomic.Int32
+	var cancelled atomic.Int32
+	release := make(chan struct{})
+	finished := make(chan struct{}, 5)
+	process := func(ctx context.Context, task *entity.QueueTask) {
+		defer func() { finished <- struct{}{} }()
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			cancelled.Add(1)
+		}
+		active.Add(-1)
+		// Задача, возвращенная в очередь при завершении, не должна подтверждаться повторно
+		w.ack(ctx, "tasks", task)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.pulling.Add(1)
+	go func() {
+		defer w.pulling.Done()
+		w.consume(ctx, "tasks", process)
+	}()
+
+	// Пул заполнен: остальные задачи должны остаться в очереди
+	time.Sleep(50 * time.Millisecond)
+	queue.mu.Lock()
+	left := len(queue.tasks)
+	queue.mu.Unlock()
+	if left != 3 {
+		t.Errorf("Expected 3 tasks left in queue while pool is full, got %d", left)
+	}
+
+	// Обработчики не завершаются до истечения срока: задачи возвращаются в очередь
+	cancel()
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer drainCancel()
+	if err := w.Shutdown(drainCtx); err == nil {
+		t.Error("Expected shutdown to time out")
+	}
+	close(release)
+	for range 2 {
+		<-finished
+	}
+
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 concurrent tasks, got %d", peak.Load())
+	}
+	if len(queue.requeued) != 2 {
+		t.Errorf("Expected 2 unfinished tasks to be requeued, got %v", queue.requeued)
+	}
+	if cancelled.Load() != 2 {
+		t.Errorf("Expected processing of requeued tasks to be cancelled, got %d cancelled", cancelled.Load())
+	}
+	if len(queue.acked) != 0 {
+		t.Errorf("Expected requeued tasks not to be acked by their handlers, got %v", queue.acked)
+	}
+}
+
+// fakeOutbox хранит неотправленные сообщения в памяти.
+type fakeOutbox struct {
+	pending []*entity.OutboxMessage
+}
+
+func (o *fakeOutbox) PublishOutbox(ctx context.Context, limit int, publish func(*entity.OutboxMessage) error) (int, error) {
+	n := 0
+	for n < len(o.pending) && n < limit {
+		if err := publish(o.pending[n]); err != nil {
+			o.pending = o.pending[n:]
+			return n, err
+		}
+		n++
+	}
+	o.pending = o.pending[n:]
+	return n, nil
+}
+func (o *fakeOutbox) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) { return 0, nil }
+
+// countingQueue считает опубликованные задачи.
+type countingQueue struct {
+	fakeQueue
+	enqueued int
+	failAt   int
+}
+
+func (q *countingQueue) Enqueue(ctx context.Context, queue string, payload interface{}) error {
+	if q.enqueued == q.failAt {
+		return context.DeadlineExceeded
+	}
+	q.enqueued++
+	return nil
+}
+
+func TestOutboxRelay_PublishesInBatches(t *testing.T) {
+	outbox := &fakeOutbox{}
+	for i := range 250 {
+		outbox.pending = append(outbox.pending, &entity.OutboxMessage{ID: int64(i), Queue: "webhook_tasks", Payload: json.RawMessage(`{}`)})
+	}
+	queue := &countingQueue{failAt: 120}
+
+	relay := NewOutboxRelay(outbox, queue, time.Second)
+	relay.relay(context.Background())
+
+	// Ошибка публикации останавливает ретрансляцию, неопубликованные сообщения остаются
+	if queue.enqueued != 120 || len(outbox.pending) != 130 {
+		t.Fatalf("Expected 120 published and 130 pending, got %d and %d", queue.enqueued, len(outbox.pending))
+	}
+
+	queue.failAt = -1
+	relay.relay(context.Background())
+	if queue.enqueued != 250 || len(outbox.pending) != 0 {
+		t.Errorf("Expected all messages to be published, got %d published, %d pending", queue.enqueued, len(outbox.pending))
+	}
+}
@@ -0,0 +1,2 @@
+-- Произвольная геометрия зоны (GeoJSON Polygon/MultiPolygon). NULL означает круговую зону.
+ALTER TABLE incidents ADD COLUMN geometry JSONB;
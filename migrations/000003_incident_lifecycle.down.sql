@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_incidents_status_expires_at;
+ALTER TABLE incidents
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS starts_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,8 @@
+ALTER TABLE incidents
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('draft', 'active', 'resolved', 'archived')),
+    ADD COLUMN starts_at TIMESTAMPTZ,
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- Для выборки активных инцидентов и поиска истекших
+CREATE INDEX idx_incidents_status_expires_at ON incidents (status, expires_at);
@@ -0,0 +1,9 @@
+CREATE TABLE webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',  -- пусто: все типы событий
+    incident_ids INTEGER[] NOT NULL DEFAULT '{}', -- пусто: все инциденты
+    secret TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
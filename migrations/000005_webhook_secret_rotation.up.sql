@@ -0,0 +1,2 @@
+-- Секреты до ротации: доставки подписываются и ими, пока получатель не перейдет на новый секрет
+ALTER TABLE webhook_subscriptions ADD COLUMN previous_secrets TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE webhook_subscriptions
+    DROP COLUMN max_attempts,
+    DROP COLUMN max_age_seconds;
@@ -0,0 +1,4 @@
+-- Ограничения повторных попыток доставки для подписки (0 — настройки воркера по умолчанию)
+ALTER TABLE webhook_subscriptions
+    ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0 CHECK (max_attempts >= 0),
+    ADD COLUMN max_age_seconds INTEGER NOT NULL DEFAULT 0 CHECK (max_age_seconds >= 0);
@@ -0,0 +1,12 @@
+-- Transactional outbox: задачи очереди, записанные в одной транзакции с проверкой местоположения
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    queue TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ
+);
+
+-- Ретранслятор выбирает только неотправленные сообщения
+CREATE INDEX idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX idx_outbox_sent_at ON outbox (sent_at) WHERE sent_at IS NOT NULL;
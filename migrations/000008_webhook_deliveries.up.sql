@@ -0,0 +1,23 @@
+-- Журнал доставки вебхуков: каждая попытка отправки события подписчику
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id TEXT NOT NULL,
+    subscription_id INTEGER NOT NULL, -- 0 — подписчик по умолчанию (WEBHOOK_URL); подписка могла быть удалена
+    url TEXT NOT NULL,
+    event TEXT NOT NULL,
+    incident_id INTEGER NOT NULL DEFAULT 0,
+    user_id TEXT NOT NULL DEFAULT '',
+    attempt INTEGER NOT NULL,
+    request_body JSONB NOT NULL,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL CHECK (status IN ('succeeded', 'failed')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+CREATE INDEX idx_webhook_deliveries_delivery_id ON webhook_deliveries (delivery_id);
+CREATE INDEX idx_webhook_deliveries_incident_id ON webhook_deliveries (incident_id, created_at);
+CREATE INDEX idx_webhook_deliveries_user_id ON webhook_deliveries (user_id, created_at);
+CREATE INDEX idx_webhook_deliveries_status ON webhook_deliveries (status, created_at);
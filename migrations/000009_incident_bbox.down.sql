@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_incidents_created_at;
+DROP INDEX IF EXISTS idx_incidents_bbox;
+DROP TRIGGER IF EXISTS trg_incidents_set_bbox ON incidents;
+DROP FUNCTION IF EXISTS incidents_set_bbox();
+ALTER TABLE incidents
+    DROP COLUMN IF EXISTS min_lat,
+    DROP COLUMN IF EXISTS min_lon,
+    DROP COLUMN IF EXISTS max_lat,
+    DROP COLUMN IF EXISTS max_lon;
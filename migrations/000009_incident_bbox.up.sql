@@ -0,0 +1,45 @@
+-- Охватывающий прямоугольник зоны для выборки инцидентов по области карты.
+-- Поддерживается триггером: для круговых зон — с запасом по радиусу, для полигонов — по координатам внешних контуров.
+ALTER TABLE incidents
+    ADD COLUMN min_lat DOUBLE PRECISION,
+    ADD COLUMN min_lon DOUBLE PRECISION,
+    ADD COLUMN max_lat DOUBLE PRECISION,
+    ADD COLUMN max_lon DOUBLE PRECISION;
+
+CREATE OR REPLACE FUNCTION incidents_set_bbox() RETURNS trigger AS $$
+DECLARE
+    dlat DOUBLE PRECISION;
+    dlon DOUBLE PRECISION;
+BEGIN
+    IF NEW.geometry IS NULL THEN
+        -- Длина градуса дуги для радиуса Земли 6371 км (как в distanceMeters)
+        dlat := NEW.radius_meters / (2 * pi() * 6371000 / 360) * 1.01;
+        dlon := 360;
+        IF cos(radians(LEAST(abs(NEW.latitude) + dlat, 90))) > 1e-9 THEN
+            dlon := LEAST(dlat / cos(radians(LEAST(abs(NEW.latitude) + dlat, 90))), 360);
+        END IF;
+        NEW.min_lat := NEW.latitude - dlat;
+        NEW.max_lat := NEW.latitude + dlat;
+        NEW.min_lon := NEW.longitude - dlon;
+        NEW.max_lon := NEW.longitude + dlon;
+    ELSE
+        SELECT min((p->>1)::float8), min((p->>0)::float8), max((p->>1)::float8), max((p->>0)::float8)
+        INTO NEW.min_lat, NEW.min_lon, NEW.max_lat, NEW.max_lon
+        FROM jsonb_path_query(NEW.geometry, CASE NEW.geometry->>'type'
+                WHEN 'Polygon' THEN '$.coordinates[0][*]'
+                ELSE '$.coordinates[*][0][*]'
+            END::jsonpath) AS p;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_incidents_set_bbox
+    BEFORE INSERT OR UPDATE OF latitude, longitude, radius_meters, geometry ON incidents
+    FOR EACH ROW EXECUTE FUNCTION incidents_set_bbox();
+
+-- Заполняем прямоугольники уже существующих инцидентов (срабатывает триггер)
+UPDATE incidents SET geometry = geometry;
+
+CREATE INDEX idx_incidents_bbox ON incidents (min_lat, max_lat, min_lon, max_lon);
+CREATE INDEX idx_incidents_created_at ON incidents (created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_created_at_id;
+DROP INDEX IF EXISTS idx_location_checks_user_checked_at_id;
+DROP INDEX IF EXISTS idx_location_checks_checked_at_id;
+DROP INDEX IF EXISTS idx_incidents_created_at_id;
+CREATE INDEX idx_incidents_created_at ON incidents (created_at);
@@ -0,0 +1,6 @@
+-- Индексы для постраничной выборки по курсору (время, id)
+DROP INDEX IF EXISTS idx_incidents_created_at;
+CREATE INDEX idx_incidents_created_at_id ON incidents (created_at, id);
+CREATE INDEX idx_location_checks_checked_at_id ON location_checks (checked_at, id);
+CREATE INDEX idx_location_checks_user_checked_at_id ON location_checks (user_id, checked_at, id);
+CREATE INDEX idx_webhook_deliveries_created_at_id ON webhook_deliveries (created_at, id);
@@ -0,0 +1,10 @@
+ALTER TABLE webhook_subscriptions
+    DROP COLUMN IF EXISTS min_severity,
+    DROP COLUMN IF EXISTS categories;
+
+DROP INDEX IF EXISTS idx_incidents_category;
+DROP INDEX IF EXISTS idx_incidents_severity;
+
+ALTER TABLE incidents
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS severity;
@@ -0,0 +1,14 @@
+-- Уровень опасности и категория инцидента
+ALTER TABLE incidents
+    ADD COLUMN severity TEXT NOT NULL DEFAULT 'danger'
+        CHECK (severity IN ('info', 'warning', 'danger', 'evacuate')),
+    ADD COLUMN category TEXT NOT NULL DEFAULT 'other'
+        CHECK (category IN ('fire', 'flood', 'chemical', 'police', 'medical', 'weather', 'infrastructure', 'other'));
+
+CREATE INDEX idx_incidents_severity ON incidents (severity);
+CREATE INDEX idx_incidents_category ON incidents (category);
+
+-- Фильтры подписок по категории и минимальному уровню опасности
+ALTER TABLE webhook_subscriptions
+    ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}', -- пусто: все категории
+    ADD COLUMN min_severity TEXT NOT NULL DEFAULT ''; -- пусто: любой уровень
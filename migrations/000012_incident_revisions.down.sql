@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS incident_revisions;
+
+-- Удаленные инциденты не удаляются (вместе с ними каскадно пропали бы связи с проверками и статистика):
+-- без deleted_at они переводятся в статус archived и не участвуют в проверках, а прежние статус и время удаления
+-- сохраняются в incidents_deleted_archive
+CREATE TABLE IF NOT EXISTS incidents_deleted_archive (
+    incident_id INTEGER PRIMARY KEY REFERENCES incidents(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+INSERT INTO incidents_deleted_archive (incident_id, status, deleted_at)
+SELECT id, status, deleted_at FROM incidents WHERE deleted_at IS NOT NULL
+ON CONFLICT (incident_id) DO UPDATE SET status = EXCLUDED.status, deleted_at = EXCLUDED.deleted_at;
+UPDATE incidents SET status = 'archived' WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE incidents DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,44 @@
+-- Мягкое удаление: строка инцидента остается, чтобы сохранить историю и связи с проверками местоположения
+ALTER TABLE incidents ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Инциденты, удаленные до отката этой миграции (см. down), снова помечаются удаленными с прежним статусом
+CREATE TABLE IF NOT EXISTS incidents_deleted_archive (
+    incident_id INTEGER PRIMARY KEY REFERENCES incidents(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+UPDATE incidents i SET deleted_at = a.deleted_at,
+                       status = CASE WHEN i.status = 'archived' THEN a.status ELSE i.status END
+FROM incidents_deleted_archive a WHERE a.incident_id = i.id;
+DROP TABLE incidents_deleted_archive;
+
+-- История изменений инцидента: состояние после каждого изменения, автор и время
+CREATE TABLE incident_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('created', 'updated', 'deleted', 'restored', 'expired')),
+    actor TEXT NOT NULL,
+    snapshot JSONB NOT NULL, -- инцидент в формате API
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (incident_id, revision)
+);
+
+-- Существующие инциденты получают первую ревизию с текущим состоянием
+INSERT INTO incident_revisions (incident_id, revision, action, actor, snapshot, created_at)
+SELECT id, 1, 'created', 'migration', jsonb_strip_nulls(jsonb_build_object(
+           'id', id,
+           'title', title,
+           'description', COALESCE(description, ''),
+           'latitude', latitude,
+           'longitude', longitude,
+           'radius_meters', radius_meters,
+           'geometry', geometry,
+           'status', status,
+           'severity', severity,
+           'category', category,
+           'starts_at', starts_at,
+           'expires_at', expires_at,
+           'created_at', created_at AT TIME ZONE 'UTC')),
+       created_at AT TIME ZONE 'UTC'
+FROM incidents;
@@ -0,0 +1,7 @@
+-- Срок действия предыдущих секретов: элемент с тем же индексом, что и в previous_secrets
+ALTER TABLE webhook_subscriptions ADD COLUMN previous_secrets_expire_at TIMESTAMPTZ[] NOT NULL DEFAULT '{}';
+
+-- Уже действующие предыдущие секреты истекают через сутки после миграции
+UPDATE webhook_subscriptions
+SET previous_secrets_expire_at = array_fill(NOW() + INTERVAL '24 hours', ARRAY[cardinality(previous_secrets)])
+WHERE cardinality(previous_secrets) > 0;
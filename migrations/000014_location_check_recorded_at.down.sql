@@ -0,0 +1 @@
+ALTER TABLE location_checks DROP COLUMN IF EXISTS recorded_at;
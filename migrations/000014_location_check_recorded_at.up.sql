@@ -0,0 +1,3 @@
+-- Время фиксации точки на устройстве клиента (момент времени, поэтому с часовым поясом);
+-- checked_at остается временем получения сервером
+ALTER TABLE location_checks ADD COLUMN recorded_at TIMESTAMPTZ;
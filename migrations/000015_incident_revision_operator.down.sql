@@ -0,0 +1 @@
+ALTER TABLE incident_revisions DROP COLUMN IF EXISTS operator;
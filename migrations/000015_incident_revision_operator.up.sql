@@ -0,0 +1,3 @@
+-- Автор ревизии (actor) — имя API-ключа, которым выполнено изменение; оператор из X-Operator указывается клиентом
+-- и хранится отдельно. В ранее записанных ревизиях actor содержит значение X-Operator
+ALTER TABLE incident_revisions ADD COLUMN operator TEXT;
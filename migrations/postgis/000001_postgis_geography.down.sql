@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_incidents_geog;
+DROP TRIGGER IF EXISTS trg_incidents_set_geog ON incidents;
+DROP FUNCTION IF EXISTS incidents_set_geog();
+ALTER TABLE incidents DROP COLUMN IF EXISTS geog;
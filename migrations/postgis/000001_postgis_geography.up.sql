@@ -0,0 +1,27 @@
+-- Опциональная схема для репозитория на PostGIS (INCIDENT_STORE=postgis).
+-- Применяется поверх основных миграций с отдельной таблицей версий (см. scripts/migrations/Makefile).
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+-- Зона инцидента в виде geography: полигон для полигональных зон
+-- и буфер вокруг центра для круговых (используется для индексного отбора по охватывающему прямоугольнику).
+ALTER TABLE incidents ADD COLUMN geog geography(Geometry, 4326);
+
+CREATE OR REPLACE FUNCTION incidents_set_geog() RETURNS trigger AS $$
+BEGIN
+    IF NEW.geometry IS NULL THEN
+        NEW.geog := ST_Buffer(ST_SetSRID(ST_MakePoint(NEW.longitude, NEW.latitude), 4326)::geography, NEW.radius_meters, 'quad_segs=32');
+    ELSE
+        NEW.geog := ST_SetSRID(ST_GeomFromGeoJSON(NEW.geometry::text), 4326)::geography;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_incidents_set_geog
+    BEFORE INSERT OR UPDATE OF latitude, longitude, radius_meters, geometry ON incidents
+    FOR EACH ROW EXECUTE FUNCTION incidents_set_geog();
+
+-- Заполняем колонку для уже существующих инцидентов (срабатывает триггер)
+UPDATE incidents SET geometry = geometry;
+
+CREATE INDEX idx_incidents_geog ON incidents USING GIST (geog);